@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"goServices/pkg/auth"
 	"goServices/pkg/handlers"
 	"goServices/pkg/middleware"
 	"goServices/pkg/models"
+	"goServices/pkg/notify"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -17,32 +23,614 @@ import (
 
 func GetDB() (*gorm.DB, error) {
 	dsn := os.Getenv("DATABASE_URL")
-	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// TranslateError convierte las violaciones de unicidad en gorm.ErrDuplicatedKey
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 }
 
-func setupRoutes(app *fiber.App, db *gorm.DB) {
+// Services dependencias compartidas por las rutas
+type Services struct {
+	Verifier      auth.TokenVerifier
+	Roles         *auth.RoleCache
+	Permissions   *auth.PermissionService
+	Tokens        *auth.TokenService
+	Revocations   auth.RevocationStore
+	MFA           *auth.MFAService
+	Passkeys      *auth.PasskeyService
+	OTP           *auth.OTPService
+	Verification  *auth.VerificationService
+	Passwords     *auth.PasswordService
+	OIDC          *auth.OIDCProvider
+	Exchange      *auth.ExchangeService
+	Clients       *auth.ClientService
+	APIKeys       *auth.APIKeyService
+	Impersonation *auth.ImpersonationService
+	Lockout       *auth.LockoutService
+	History       *auth.LoginHistoryService
+	Federation    *auth.FederationService
+	Accounts      *auth.AccountService
+	Profiles      *auth.ProfileService
+}
+
+// maxTokenTTL retención de las revocaciones; cubre la vida de los tokens de
+// Supabase (1h por defecto) y de los propios
+const maxTokenTTL = 24 * time.Hour
+
+// GetSupabaseVerifier construye el verificador de JWT de Supabase desde el entorno.
+// Devuelve nil si Supabase no está configurado (solo tokens propios).
+func GetSupabaseVerifier(ctx context.Context) (*auth.Verifier, error) {
+	cfg := auth.VerifierConfig{
+		HMACSecret: []byte(os.Getenv("SUPABASE_JWT_SECRET")),
+		Audience:   []string{"authenticated"},
+		Leeway:     30 * time.Second,
+	}
+
+	if aud := os.Getenv("JWT_AUDIENCE"); aud != "" {
+		cfg.Audience = strings.Split(aud, ",")
+	}
+
+	// Supabase emite sus tokens con iss = <SUPABASE_URL>/auth/v1
+	cfg.Issuer = os.Getenv("JWT_ISSUER")
+	if cfg.Issuer == "" && os.Getenv("SUPABASE_URL") != "" {
+		cfg.Issuer = strings.TrimRight(os.Getenv("SUPABASE_URL"), "/") + "/auth/v1"
+	}
+
+	// Claves asimétricas desde JWKS remoto o archivo local, con rotación
+	var source auth.JWKSSource
+	if jwksURL := os.Getenv("SUPABASE_JWKS_URL"); jwksURL != "" {
+		source = auth.URLSource{URL: jwksURL}
+	} else if jwksFile := os.Getenv("SUPABASE_JWKS_FILE"); jwksFile != "" {
+		source = auth.FileSource{Path: jwksFile}
+	}
+
+	if source != nil {
+		refresh, _ := time.ParseDuration(os.Getenv("JWKS_REFRESH_INTERVAL"))
+		keys, err := auth.NewKeyCache(ctx, auth.KeyCacheConfig{
+			Source:          source,
+			RefreshInterval: refresh,
+		})
+		if err != nil {
+			return nil, err
+		}
+		keys.Start(ctx)
+		cfg.Keys = keys
+	}
+
+	if len(cfg.HMACSecret) == 0 && cfg.Keys == nil {
+		return nil, nil
+	}
+
+	return auth.NewVerifier(cfg), nil
+}
+
+// GetKeyRing configura las claves de firma de los tokens propios. Con
+// AUTH_SIGNING_KEY_FILE se usa esa clave fija; si no, las claves se guardan en la
+// base y rotan cada AUTH_KEY_ROTATION.
+func GetKeyRing(db *gorm.DB) (*auth.KeyRing, error) {
+	if keyFile := os.Getenv("AUTH_SIGNING_KEY_FILE"); keyFile != "" {
+		signer, err := auth.LoadSigner(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewStaticKeyRing(signer), nil
+	}
+
+	secret := os.Getenv("AUTH_KEYS_SECRET")
+	if secret == "" {
+		log.Println("Warning: AUTH_KEYS_SECRET not set, signing keys are stored unencrypted")
+	}
+	rotation, _ := time.ParseDuration(os.Getenv("AUTH_KEY_ROTATION"))
+
+	return auth.NewKeyRing(db, auth.KeyRingConfig{
+		RotationInterval: rotation,
+		Retention:        2 * maxTokenTTL,
+		Secret:           []byte(secret),
+	})
+}
+
+// GetTokenService configura la emisión de tokens propios desde el entorno
+func GetTokenService(db *gorm.DB, keys *auth.KeyRing) *auth.TokenService {
+	accessTTL, _ := time.ParseDuration(os.Getenv("AUTH_ACCESS_TTL"))
+	refreshTTL, _ := time.ParseDuration(os.Getenv("AUTH_REFRESH_TTL"))
+
+	return auth.NewTokenService(db, auth.TokenServiceConfig{
+		Keys:       keys,
+		Issuer:     authIssuer(),
+		AccessTTL:  accessTTL,
+		RefreshTTL: refreshTTL,
+	})
+}
+
+// authIssuer iss de los tokens propios; para actuar como proveedor OIDC debe ser
+// la URL pública del servicio
+func authIssuer() string {
+	if issuer := os.Getenv("AUTH_ISSUER"); issuer != "" {
+		return strings.TrimRight(issuer, "/")
+	}
+	return "goServices-auth"
+}
+
+// GetRevocationStore elige el backend de revocaciones (REVOCATION_STORE=memory|postgres)
+func GetRevocationStore(db *gorm.DB) auth.RevocationStore {
+	if os.Getenv("REVOCATION_STORE") == "memory" {
+		return auth.NewMemoryRevocationStore(maxTokenTTL)
+	}
+	return auth.NewPostgresRevocationStore(db, maxTokenTTL)
+}
+
+// GetLockoutService configura la protección contra fuerza bruta desde el entorno
+func GetLockoutService(db *gorm.DB) *auth.LockoutService {
+	freeAttempts, _ := strconv.Atoi(os.Getenv("LOCKOUT_FREE_ATTEMPTS"))
+	captchaAfter, _ := strconv.Atoi(os.Getenv("LOCKOUT_CAPTCHA_AFTER"))
+	maxDelay, _ := time.ParseDuration(os.Getenv("LOCKOUT_MAX_DELAY"))
+	window := time.Hour
+
+	var store auth.AttemptStore = auth.NewPostgresAttemptStore(db, window)
+	if os.Getenv("LOCKOUT_STORE") == "memory" {
+		store = auth.NewMemoryAttemptStore(window)
+	}
+
+	return auth.NewLockoutService(db, store, auth.LockoutConfig{
+		Account: auth.LockoutPolicy{
+			FreeAttempts: freeAttempts,
+			CaptchaAfter: captchaAfter,
+			MaxDelay:     maxDelay,
+		},
+		IP:     auth.LockoutPolicy{MaxDelay: maxDelay},
+		Window: window,
+	})
+}
+
+// GetPasskeyService configura el relying party WebAuthn desde el entorno
+func GetPasskeyService(db *gorm.DB) (*auth.PasskeyService, error) {
+	cfg := auth.PasskeyConfig{
+		RPID:          os.Getenv("WEBAUTHN_RP_ID"),
+		RPDisplayName: os.Getenv("WEBAUTHN_RP_NAME"),
+		RPOrigins:     []string{"http://localhost:3000"},
+	}
+	if cfg.RPID == "" {
+		cfg.RPID = "localhost"
+	}
+	if cfg.RPDisplayName == "" {
+		cfg.RPDisplayName = "Transport Services"
+	}
+	if origins := os.Getenv("WEBAUTHN_RP_ORIGINS"); origins != "" {
+		cfg.RPOrigins = strings.Split(origins, ",")
+	}
+
+	return auth.NewPasskeyService(db, cfg)
+}
+
+// GetSender configura la entrega de mensajes: los emails van por SMTP si
+// SMTP_HOST está definido y, si no, igual que los SMS a stdout o archivo
+// (NOTIFY_SENDER=stdout|file)
+func GetSender() (notify.Sender, error) {
+	var local notify.Sender = notify.NewStdoutSender()
+	if os.Getenv("NOTIFY_SENDER") == "file" {
+		path := os.Getenv("NOTIFY_FILE")
+		if path == "" {
+			path = "notifications.log"
+		}
+		fileSender, err := notify.NewFileSender(path)
+		if err != nil {
+			return nil, err
+		}
+		local = fileSender
+	}
+
+	router := notify.Router{Email: local, SMS: local}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		from := os.Getenv("SMTP_FROM")
+		if from == "" {
+			from = "no-reply@localhost"
+		}
+		router.Email = notify.NewSMTPSender(notify.SMTPConfig{
+			Host:     host,
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+	}
+	return router, nil
+}
+
+// GetOTPService configura el login sin contraseña desde el entorno
+func GetOTPService(db *gorm.DB, sender notify.Sender) *auth.OTPService {
+	magicLinkURL := os.Getenv("MAGIC_LINK_URL")
+	if magicLinkURL == "" {
+		magicLinkURL = "http://localhost:3000/auth/magic-link"
+	}
+
+	return auth.NewOTPService(db, auth.OTPConfig{
+		Sender:       sender,
+		MagicLinkURL: magicLinkURL,
+	})
+}
+
+// GetVerificationService configura la verificación de email y teléfono desde el entorno
+func GetVerificationService(db *gorm.DB, sender notify.Sender) *auth.VerificationService {
+	verifyEmailURL := os.Getenv("VERIFY_EMAIL_URL")
+	if verifyEmailURL == "" {
+		verifyEmailURL = "http://localhost:3000/auth/verify-email"
+	}
+
+	return auth.NewVerificationService(db, auth.VerificationConfig{
+		Sender:         sender,
+		VerifyEmailURL: verifyEmailURL,
+	})
+}
+
+// requiredVerifications contactos que deben estar verificados en las rutas
+// protegidas (REQUIRE_VERIFIED=email,telefono); vacío no exige nada. Un valor
+// desconocido detiene el arranque en lugar de dejar las rutas sin proteger.
+func requiredVerifications() []string {
+	var required []string
+	for _, v := range strings.Split(os.Getenv("REQUIRE_VERIFIED"), ",") {
+		switch v = strings.TrimSpace(v); v {
+		case "":
+		case models.VerificacionEmail, models.VerificacionTelefono:
+			required = append(required, v)
+		default:
+			log.Fatalf("Invalid REQUIRE_VERIFIED value %q: use %s or %s", v, models.VerificacionEmail, models.VerificacionTelefono)
+		}
+	}
+	return required
+}
+
+// GetPasswordService configura el restablecimiento de contraseña desde el entorno
+func GetPasswordService(db *gorm.DB, tokens *auth.TokenService, sender notify.Sender) *auth.PasswordService {
+	resetURL := os.Getenv("PASSWORD_RESET_URL")
+	if resetURL == "" {
+		resetURL = "http://localhost:3000/auth/reset-password"
+	}
+
+	return auth.NewPasswordService(db, tokens, auth.PasswordConfig{
+		Sender:   sender,
+		ResetURL: resetURL,
+	})
+}
+
+// GetOIDCProvider configura el proveedor OIDC; el cliente se registra con
+// OIDC_CLIENT_ID y OIDC_REDIRECT_URIS (separadas por comas)
+func GetOIDCProvider(db *gorm.DB, tokens *auth.TokenService, keys *auth.KeyRing) *auth.OIDCProvider {
+	loginURL := os.Getenv("OIDC_LOGIN_URL")
+	if loginURL == "" {
+		loginURL = "http://localhost:5173/login"
+	}
+
+	cfg := auth.OIDCConfig{
+		Issuer:   authIssuer(),
+		LoginURL: loginURL,
+	}
+	if clientID := os.Getenv("OIDC_CLIENT_ID"); clientID != "" {
+		client := auth.OIDCClient{ID: clientID}
+		for _, uri := range strings.Split(os.Getenv("OIDC_REDIRECT_URIS"), ",") {
+			if uri = strings.TrimSpace(uri); uri != "" {
+				client.RedirectURIs = append(client.RedirectURIs, uri)
+			}
+		}
+		cfg.Clients = append(cfg.Clients, client)
+	}
+	return auth.NewOIDCProvider(db, tokens, keys, cfg)
+}
+
+// GetExchangeService configura el token exchange. TOKEN_EXCHANGE_AUDIENCES lista
+// los servicios internos y sus scopes: "payments=payments:read payments:write;orders=orders:read"
+func GetExchangeService(svc Services, keys *auth.KeyRing) *auth.ExchangeService {
+	audiences := map[string][]string{}
+	for _, entry := range strings.Split(os.Getenv("TOKEN_EXCHANGE_AUDIENCES"), ";") {
+		aud, scopes, found := strings.Cut(entry, "=")
+		if aud = strings.TrimSpace(aud); aud == "" || !found {
+			continue
+		}
+		audiences[aud] = strings.Fields(scopes)
+	}
+	ttl, _ := time.ParseDuration(os.Getenv("TOKEN_EXCHANGE_TTL"))
+
+	return auth.NewExchangeService(auth.ExchangeConfig{
+		Verifier:    svc.Verifier,
+		Revocations: svc.Revocations,
+		Sessions:    svc.Tokens,
+		Accounts:    svc.Roles,
+		Keys:        keys,
+		Issuer:      authIssuer(),
+		Audiences:   audiences,
+		TTL:         ttl,
+	})
+}
+
+// GetClientService configura los tokens de servicio (client credentials)
+func GetClientService(db *gorm.DB, keys *auth.KeyRing) *auth.ClientService {
+	ttl, _ := time.ParseDuration(os.Getenv("SERVICE_TOKEN_TTL"))
+
+	return auth.NewClientService(db, auth.ClientConfig{
+		Keys:   keys,
+		Issuer: authIssuer(),
+		TTL:    ttl,
+	})
+}
+
+// GetAPIKeyService configura las claves API desde el entorno
+func GetAPIKeyService(db *gorm.DB) *auth.APIKeyService {
+	ttl, _ := time.ParseDuration(os.Getenv("API_KEY_TTL"))
+	rateLimit, _ := strconv.Atoi(os.Getenv("API_KEY_RATE_LIMIT"))
+
+	return auth.NewAPIKeyService(db, auth.APIKeyConfig{
+		DefaultTTL:       ttl,
+		DefaultRateLimit: rateLimit,
+	})
+}
+
+// GetImpersonationService configura la suplantación de usuarios por admins
+func GetImpersonationService(db *gorm.DB, tokens *auth.TokenService) *auth.ImpersonationService {
+	ttl, _ := time.ParseDuration(os.Getenv("IMPERSONATION_TTL"))
+	return auth.NewImpersonationService(db, tokens, ttl)
+}
+
+// GetOutboxWorker configura la entrega de la outbox; OUTBOX_RETENTION_DAYS son los
+// días que se conservan los mensajes enviados o abandonados
+func GetOutboxWorker(db *gorm.DB, delivery notify.Sender) *notify.OutboxWorker {
+	days, _ := strconv.Atoi(os.Getenv("OUTBOX_RETENTION_DAYS"))
+	return notify.NewOutboxWorker(db, notify.OutboxWorkerConfig{
+		Sender:    delivery,
+		Retention: time.Duration(days) * 24 * time.Hour,
+	})
+}
+
+// GetLoginHistoryService configura el historial de logins y el aviso de
+// dispositivos nuevos por email
+func GetLoginHistoryService(db *gorm.DB, sender notify.Sender) *auth.LoginHistoryService {
+	days, _ := strconv.Atoi(os.Getenv("LOGIN_HISTORY_RETENTION_DAYS"))
+	return auth.NewLoginHistoryService(db, auth.LoginHistoryConfig{
+		Notifier:  auth.NewEmailDeviceNotifier(db, sender),
+		Retention: time.Duration(days) * 24 * time.Hour,
+	})
+}
+
+// GetProfileService configura los perfiles de cliente; con PROFILE_AUTO_CREATE=true
+// se crea un perfil vacío la primera vez que el usuario lo necesita
+func GetProfileService(db *gorm.DB) *auth.ProfileService {
+	return auth.NewProfileService(db, auth.ProfileConfig{
+		AutoCreate: os.Getenv("PROFILE_AUTO_CREATE") == "true",
+	})
+}
+
+// GetFederationService configura los proveedores OIDC externos: FEDERATION_PROVIDERS
+// lista sus ids y cada uno se configura con FEDERATION_<ID>_ISSUER, _CLIENT_ID,
+// _CLIENT_SECRET, _NAME, _SCOPES y _SIGNUP
+func GetFederationService(db *gorm.DB) (*auth.FederationService, error) {
+	redirectURL := os.Getenv("FEDERATION_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = "http://localhost:3000/auth/callback"
+	}
+
+	cfg := auth.FederationConfig{RedirectURL: redirectURL}
+	for _, id := range strings.Split(os.Getenv("FEDERATION_PROVIDERS"), ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		prefix := "FEDERATION_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_"
+		cfg.Providers = append(cfg.Providers, auth.FederationProvider{
+			ID:           id,
+			Nombre:       os.Getenv(prefix + "NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " ")),
+			AllowSignup:  os.Getenv(prefix+"SIGNUP") != "false",
+		})
+	}
+
+	return auth.NewFederationService(db, cfg)
+}
+
+// serviceAudience aud de los tokens de servicio dirigidos a este servicio
+func serviceAudience() string {
+	if aud := os.Getenv("AUTH_SERVICE_AUDIENCE"); aud != "" {
+		return aud
+	}
+	return "auth"
+}
+
+func setupRoutes(app *fiber.App, db *gorm.DB, svc Services) {
 	// Rutas públicas
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
 
+	// Discovery OIDC y claves públicas para los demás servicios
+	app.Get("/.well-known/openid-configuration", handlers.GetOpenIDConfiguration(svc.OIDC))
+	app.Get("/.well-known/jwks.json", handlers.GetJWKS(svc.OIDC))
+
+	authenticated := middleware.AuthMiddleware(middleware.AuthConfig{
+		Verifier:      svc.Verifier,
+		Roles:         svc.Roles,
+		Accounts:      svc.Roles,
+		Sessions:      svc.Tokens,
+		Revocations:   svc.Revocations,
+		Services:      svc.Clients.ServiceVerifier(serviceAudience()),
+		APIKeys:       svc.APIKeys,
+		Permissions:   svc.Permissions,
+		Impersonation: svc.Impersonation,
+	})
+
+	// Autenticación propia (email/contraseña)
+	// Todo endpoint de login u OTP propio va detrás de middleware.BruteForce
+	authGroup := app.Group("/auth")
+	authGroup.Post("/signup", handlers.Signup(db, svc.Tokens, svc.Verification))
+	authGroup.Post("/login", middleware.BruteForce(middleware.BruteForceConfig{
+		Lockout: svc.Lockout,
+		Account: handlers.LoginAccount,
+		Method:  auth.AMRPassword,
+		History: svc.History,
+	}), handlers.Login(db, svc.Tokens, svc.MFA))
+	authGroup.Post("/2fa/verify", middleware.BruteForce(middleware.BruteForceConfig{
+		Lockout: svc.Lockout,
+		Account: handlers.MFAAccount(svc.Tokens),
+		Method:  auth.AMRTOTP,
+		History: svc.History,
+	}), handlers.VerifyLoginMFA(db, svc.Tokens, svc.MFA))
+	authGroup.Post("/password/forgot", handlers.ForgotPassword(svc.Passwords))
+	authGroup.Post("/password/reset", handlers.ResetPassword(svc.Passwords))
+	authGroup.Post("/verify-email", handlers.VerifyEmail(svc.Verification))
+	authGroup.Post("/otp/request", middleware.BruteForce(middleware.BruteForceConfig{
+		Lockout:   svc.Lockout,
+		Account:   handlers.OTPAccount,
+		CheckOnly: true,
+	}), handlers.RequestOTP(svc.OTP))
+	authGroup.Post("/otp/verify", middleware.BruteForce(middleware.BruteForceConfig{
+		Lockout: svc.Lockout,
+		Account: handlers.OTPAccount,
+		Method:  auth.AMROTP,
+		History: svc.History,
+	}), handlers.VerifyOTP(db, svc.Tokens, svc.OTP, svc.MFA))
+	authGroup.Post("/passkeys/login/begin", handlers.BeginPasskeyLogin(svc.Passkeys))
+	authGroup.Post("/passkeys/login/finish", middleware.BruteForce(middleware.BruteForceConfig{
+		Lockout: svc.Lockout,
+		Method:  auth.AMRHardwareKey,
+		History: svc.History,
+	}), handlers.FinishPasskeyLogin(db, svc.Tokens, svc.Passkeys, svc.MFA))
+	authGroup.Get("/federation/providers", handlers.GetFederationProviders(svc.Federation))
+	authGroup.Post("/federation/:proveedor/begin", handlers.BeginFederatedLogin(svc.Federation))
+	authGroup.Post("/federation/callback", middleware.BruteForce(middleware.BruteForceConfig{
+		Lockout: svc.Lockout,
+		Method:  auth.AMRFederated,
+		History: svc.History,
+	}), handlers.FederatedLoginCallback(db, svc.Tokens, svc.Federation, svc.MFA))
+	authGroup.Post("/refresh", handlers.Refresh(svc.Tokens))
+	authGroup.Post("/logout", handlers.Logout(svc.Tokens))
+
+	// Proveedor OIDC (authorization code + PKCE)
+	authGroup.Get("/authorize", handlers.Authorize(svc.OIDC))
+	authGroup.Post("/token", handlers.Token(svc.OIDC, svc.Exchange, svc.Clients))
+	authGroup.Get("/userinfo", authenticated, handlers.UserInfo(svc.OIDC))
+
 	// Rutas autenticadas
-	api := app.Group("/api", middleware.AuthMiddleware)
+	api := app.Group("/api", authenticated)
+
+	// Rutas de credenciales y consentimientos, vedadas durante una suplantación
+	noImpersonation := middleware.DenyImpersonation()
+
+	// Aprobación de solicitudes OIDC desde la página de login
+	api.Get("/auth/authorize/:id_solicitud", handlers.GetAuthorizationRequest(svc.OIDC))
+	api.Post("/auth/authorize/:id_solicitud", noImpersonation, handlers.ApproveAuthorization(svc.OIDC))
+	api.Post("/auth/authorize/:id_solicitud/deny", noImpersonation, handlers.DenyAuthorization(svc.OIDC))
 
 	// Users endpoints
 	api.Get("/users/me", handlers.GetMe(db))
 	api.Put("/users/me", handlers.UpdateMe(db))
-	api.Get("/users/:id_usuario", handlers.GetUser(db))
+	api.Put("/users/me/password", noImpersonation, handlers.ChangePassword(svc.Passwords))
+	api.Get("/users/me/permissions", handlers.GetMyPermissions())
+	api.Get("/users/me/login-history", handlers.GetMyLoginHistory(svc.History))
+	api.Get("/users/:id_usuario/login-history", middleware.RequirePermission(auth.PermUsersRead), handlers.GetUserLoginHistory(svc.History))
+	api.Get("/users/:id_usuario", middleware.AllowService(auth.PermUsersRead), handlers.GetUser(db))
+
+	// Verification endpoints
+	api.Get("/users/me/verification", handlers.GetMyVerification(db, svc.Verification))
+	api.Post("/users/me/verification/email", handlers.SendEmailVerification(db, svc.Verification))
+	api.Post("/users/me/verification/phone", handlers.SendPhoneVerification(svc.Verification))
+	api.Post("/users/me/verification/phone/verify", handlers.VerifyPhone(svc.Verification))
+
+	// Rutas que exigen contactos verificados (REQUIRE_VERIFIED)
+	verified := middleware.RequireVerified(svc.Verification, requiredVerifications()...)
+
+	// Client profile endpoints
+	api.Get("/users/me/profile", handlers.GetMyProfile(svc.Profiles))
+	api.Post("/users/me/profile", noImpersonation, handlers.CreateMyProfile(svc.Profiles))
+	api.Put("/users/me/profile", noImpersonation, handlers.UpdateMyProfile(svc.Profiles))
 
 	// Addresses endpoints
-	api.Get("/users/me/addresses", handlers.GetMyAddresses(db))
-	api.Post("/users/me/addresses", handlers.CreateAddress(db))
-	api.Put("/users/me/addresses/:id_direccion", handlers.UpdateAddress(db))
+	api.Get("/users/me/addresses", handlers.GetMyAddresses(db, svc.Profiles))
+	api.Post("/users/me/addresses", verified, handlers.CreateAddress(db, svc.Profiles))
+	api.Put("/users/me/addresses/:id_direccion", verified, handlers.UpdateAddress(db))
 	api.Delete("/users/me/addresses/:id_direccion", handlers.DeleteAddress(db))
 
+	// Sessions endpoints
+	api.Get("/users/me/sessions", handlers.GetMySessions(svc.Tokens))
+	api.Delete("/users/me/sessions", noImpersonation, handlers.RevokeMySessions(svc.Tokens))
+	api.Delete("/users/me/sessions/:id_sesion", noImpersonation, handlers.RevokeMySession(svc.Tokens))
+
+	// 2FA endpoints
+	api.Post("/users/me/2fa/setup", noImpersonation, handlers.SetupTOTP(svc.MFA))
+	// Un token robado no debe permitir adivinar el código para enrolar o quitar el 2FA
+	mfaGuard := middleware.BruteForce(middleware.BruteForceConfig{
+		Lockout: svc.Lockout,
+		Account: handlers.PrincipalAccount,
+	})
+	api.Post("/users/me/2fa/verify", noImpersonation, mfaGuard, handlers.EnableTOTP(svc.MFA))
+	api.Post("/users/me/2fa/disable", noImpersonation, mfaGuard, handlers.DisableTOTP(svc.MFA))
+	api.Post("/users/me/2fa/recovery-codes", noImpersonation, mfaGuard, handlers.RegenerateRecoveryCodes(svc.MFA))
+
+	// Passkeys endpoints
+	api.Get("/users/me/passkeys", handlers.GetMyPasskeys(svc.Passkeys))
+	api.Post("/users/me/passkeys/register/begin", noImpersonation, handlers.BeginPasskeyRegistration(svc.Passkeys))
+	api.Post("/users/me/passkeys/register/finish", noImpersonation, handlers.FinishPasskeyRegistration(svc.Passkeys))
+	api.Put("/users/me/passkeys/:id_credencial", noImpersonation, handlers.UpdateMyPasskey(svc.Passkeys))
+	api.Delete("/users/me/passkeys/:id_credencial", noImpersonation, handlers.DeleteMyPasskey(svc.Passkeys))
+
+	// Identidades vinculadas (proveedores OIDC externos)
+	api.Get("/users/me/identities", handlers.GetMyIdentities(svc.Federation))
+	api.Post("/users/me/identities", noImpersonation, handlers.LinkIdentity(svc.Federation))
+	api.Post("/users/me/identities/callback", noImpersonation, handlers.LinkIdentityCallback(svc.Federation))
+	api.Delete("/users/me/identities/:id_identidad", noImpersonation, handlers.UnlinkIdentity(svc.Federation))
+
 	// Transportistas endpoints
-	api.Get("/transportistas", handlers.GetTransportistas(db))
-	api.Get("/transportistas/:id_transportista", handlers.GetTransportista(db))
+	api.Get("/transportistas", middleware.AllowService("transportistas:read"), handlers.GetTransportistas(db))
+	api.Get("/transportistas/:id_transportista", middleware.AllowService("transportistas:read"), handlers.GetTransportista(db))
+	api.Post("/transportistas/:id_transportista/verify", middleware.RequirePermission(auth.PermTransportistasVerify), handlers.VerifyTransportista(db))
+
+	// Admin endpoints: cada ruta exige su permiso (admin tiene todos) y las que no
+	// tienen uno propio quedan para el rol admin
+	admin := api.Group("/admin", middleware.RequireUser())
+	if os.Getenv("ADMIN_REQUIRE_MFA") == "true" {
+		admin.Use(middleware.RequireMFA())
+	}
+	adminOnly := middleware.RequireRole(models.RolAdmin)
+	usersRead := middleware.RequirePermission(auth.PermUsersRead)
+	usersWrite := middleware.RequirePermission(auth.PermUsersWrite)
+	rolesManage := middleware.RequirePermission(auth.PermRolesManage)
+	sessionsManage := middleware.RequirePermission(auth.PermSessionsManage)
+
+	admin.Get("/users", usersRead, handlers.GetAdminUsers(svc.Accounts))
+	admin.Put("/users/:id_usuario/rol", rolesManage, handlers.ChangeUserRole(svc.Accounts))
+	admin.Post("/users/:id_usuario/deactivate", usersWrite, handlers.DeactivateUser(svc.Accounts))
+	admin.Post("/users/:id_usuario/reactivate", usersWrite, handlers.ReactivateUser(svc.Accounts))
+	admin.Post("/users/:id_usuario/unlock", usersWrite, handlers.UnlockUser(svc.Lockout))
+	admin.Post("/users/:id_usuario/logout", sessionsManage, handlers.ForceLogoutUser(svc.Accounts))
+	admin.Get("/users/:id_usuario/sessions", sessionsManage, handlers.GetUserSessions(svc.Tokens, svc.Accounts))
+	admin.Delete("/users/:id_usuario/sessions", sessionsManage, handlers.RevokeUserSessions(svc.Tokens, svc.Accounts))
+	admin.Delete("/users/:id_usuario/sessions/:id_sesion", sessionsManage, handlers.RevokeUserSession(svc.Tokens, svc.Accounts))
+	admin.Get("/permissions", rolesManage, handlers.GetPermissionCatalog())
+	admin.Get("/roles", rolesManage, handlers.GetRoles(svc.Permissions))
+	admin.Post("/roles", rolesManage, handlers.CreateRole(svc.Permissions))
+	admin.Put("/roles/:rol", rolesManage, handlers.UpdateRole(svc.Permissions))
+	admin.Delete("/roles/:rol", rolesManage, handlers.DeleteRole(svc.Permissions))
+	admin.Get("/users/:id_usuario/roles", rolesManage, handlers.GetUserRoles(svc.Permissions))
+	admin.Post("/users/:id_usuario/roles", rolesManage, handlers.AssignUserRole(svc.Permissions))
+	admin.Delete("/users/:id_usuario/roles/:rol", rolesManage, handlers.UnassignUserRole(svc.Permissions))
+	admin.Post("/revocations", adminOnly, handlers.RevokeTokens(svc.Revocations, maxTokenTTL))
+	admin.Get("/service-clients", adminOnly, handlers.GetServiceClients(svc.Clients))
+	admin.Post("/service-clients", adminOnly, handlers.CreateServiceClient(svc.Clients))
+	admin.Post("/service-clients/:client_id/secret", adminOnly, handlers.RotateServiceClientSecret(svc.Clients))
+	admin.Delete("/service-clients/:client_id", adminOnly, handlers.DeactivateServiceClient(svc.Clients))
+	admin.Get("/api-keys", adminOnly, handlers.GetAPIKeys(svc.APIKeys))
+	admin.Post("/api-keys", adminOnly, handlers.CreateAPIKey(svc.APIKeys))
+	admin.Delete("/api-keys/:id_clave", adminOnly, handlers.RevokeAPIKey(svc.APIKeys))
+	admin.Post("/users/:id_usuario/impersonate", adminOnly, handlers.ImpersonateUser(svc.Impersonation))
+	admin.Get("/impersonations", adminOnly, handlers.GetImpersonationAudit(svc.Impersonation))
+}
+
+// normalizeStoredPhones normaliza los teléfonos de perfil guardados y lista los
+// verificados que chocarían entre sí, que quedan sin tocar
+func normalizeStoredPhones(db *gorm.DB) {
+	updated, collisions, err := GetProfileService(db).NormalizeStoredPhones()
+	if err != nil {
+		log.Fatalf("Failed to normalize stored phones: %v", err)
+	}
+	for _, c := range collisions {
+		log.Printf("Phone %s is verified by several users (%s); left unchanged", c.Telefono, c.Usuarios)
+	}
+	log.Printf("Normalized %d stored phones, %d collisions to review", updated, len(collisions))
 }
 
 func main() {
@@ -57,6 +645,12 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// go run main.go normalize-phones: migración única de los teléfonos guardados
+	if len(os.Args) > 1 && os.Args[1] == "normalize-phones" {
+		normalizeStoredPhones(db)
+		return
+	}
+
 	// Realizar migraciones solo para tablas que no existen
 	// Si las tablas ya existen con RLS, GORM no puede modificarlas
 	if err := db.AutoMigrate(
@@ -68,6 +662,121 @@ func main() {
 		// No paniquear, continuamos
 	}
 
+	// Tablas propias de autenticación; users puede venir sincronizada desde
+	// Supabase, por eso se migra aparte y sus errores no bloquean el resto
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		log.Printf("Warning migrating users: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.CuentaLocal{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.TokenRevocado{},
+		&models.RevocacionUsuario{},
+		&models.SegundoFactor{},
+		&models.CodigoRecuperacion{},
+		&models.Credential{},
+		&models.CeremoniaWebAuthn{},
+		&models.CodigoOTP{},
+		&models.TokenVerificacion{},
+		&models.TokenRestablecimiento{},
+		&models.MensajeSaliente{},
+		&models.ClaveFirma{},
+		&models.SolicitudAutorizacion{},
+		&models.CodigoAutorizacion{},
+		&models.ServiceClient{},
+		&models.ClaveAPI{},
+		&models.Rol{},
+		&models.RolPermiso{},
+		&models.UsuarioRol{},
+		&models.AuditoriaSuplantacion{},
+		&models.IntentoFallido{},
+		&models.RegistroLogin{},
+		&models.DispositivoConocido{},
+		&models.IdentidadVinculada{},
+		&models.SolicitudFederada{},
+	); err != nil {
+		log.Printf("Warning during auth migrations: %v", err)
+	}
+
+	// Configurar la emisión y verificación de JWT
+	keys, err := GetKeyRing(db)
+	if err != nil {
+		log.Fatalf("Failed to configure signing keys: %v", err)
+	}
+	keys.Start(context.Background(), time.Minute)
+	tokens := GetTokenService(db, keys)
+	supabase, err := GetSupabaseVerifier(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to configure JWT verification: %v", err)
+	}
+	if supabase == nil {
+		log.Println("Supabase JWT verification not configured, accepting only first-party tokens")
+	}
+
+	passkeys, err := GetPasskeyService(db)
+	if err != nil {
+		log.Fatalf("Failed to configure passkeys: %v", err)
+	}
+
+	federation, err := GetFederationService(db)
+	if err != nil {
+		log.Fatalf("Failed to configure identity providers: %v", err)
+	}
+
+	// Los mensajes se encolan en la outbox y un worker los entrega
+	delivery, err := GetSender()
+	if err != nil {
+		log.Fatalf("Failed to configure notifications: %v", err)
+	}
+	outbox := GetOutboxWorker(db, delivery)
+	outbox.Start(context.Background())
+	sender := notify.NewOutboxSender(db)
+
+	svc := Services{
+		Verifier:      auth.NewMultiVerifier(supabase, tokens.Verifier()),
+		Roles:         auth.NewRoleCache(db, time.Minute),
+		Permissions:   auth.NewPermissionService(db, time.Minute),
+		Tokens:        tokens,
+		Revocations:   GetRevocationStore(db),
+		MFA:           auth.NewMFAService(db, "Transport Services"),
+		Passkeys:      passkeys,
+		OTP:           GetOTPService(db, sender),
+		Verification:  GetVerificationService(db, sender),
+		Passwords:     GetPasswordService(db, tokens, sender),
+		OIDC:          GetOIDCProvider(db, tokens, keys),
+		Clients:       GetClientService(db, keys),
+		APIKeys:       GetAPIKeyService(db),
+		Impersonation: GetImpersonationService(db, tokens),
+		Lockout:       GetLockoutService(db),
+		History:       GetLoginHistoryService(db, sender),
+		Federation:    federation,
+		Profiles:      GetProfileService(db),
+	}
+	tokens.UseLoginRecorder(svc.History)
+	svc.Exchange = GetExchangeService(svc, keys)
+	svc.Accounts = auth.NewAccountService(db, tokens, svc.Roles, svc.Permissions, svc.Revocations)
+	if err := svc.Accounts.EnsureSearchIndex(); err != nil {
+		log.Printf("Warning creating user search index: %v", err)
+	}
+	if err := svc.Profiles.EnsurePhoneIndex(); err != nil {
+		log.Printf("Warning creating verified phone index: %v", err)
+	}
+	if err := svc.Permissions.SeedSystemRoles(); err != nil {
+		log.Printf("Warning seeding system roles: %v", err)
+	}
+	auth.StartRevocationCleanup(context.Background(), svc.Revocations, 10*time.Minute)
+	auth.StartCleanup(context.Background(), "OTP", svc.OTP, 10*time.Minute)
+	auth.StartCleanup(context.Background(), "verification", svc.Verification, time.Hour)
+	auth.StartCleanup(context.Background(), "password reset", svc.Passwords, time.Hour)
+	auth.StartCleanup(context.Background(), "outbox", outbox, time.Hour)
+	auth.StartCleanup(context.Background(), "authorization code", svc.OIDC, 10*time.Minute)
+	auth.StartCleanup(context.Background(), "signing key", keys, time.Hour)
+	auth.StartCleanup(context.Background(), "API key rate limit", svc.APIKeys, 10*time.Minute)
+	auth.StartCleanup(context.Background(), "login attempt", svc.Lockout, 10*time.Minute)
+	auth.StartCleanup(context.Background(), "login history", svc.History, 24*time.Hour)
+	auth.StartCleanup(context.Background(), "federation state", svc.Federation, 10*time.Minute)
+
 	// Crear aplicación Fiber
 	app := fiber.New(fiber.Config{
 		AppName: "Transport Services API",
@@ -81,7 +790,7 @@ func main() {
 	}))
 
 	// Configurar rutas
-	setupRoutes(app, db)
+	setupRoutes(app, db, svc)
 
 	// Iniciar servidor
 	port := os.Getenv("PORT")
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Errores de gestión de cuentas
+var (
+	ErrAccountDisabled   = errors.New("account disabled")
+	ErrAccountNotFound   = errors.New("user not found")
+	ErrInvalidUserRole   = errors.New("rol must be cliente, transportista or admin")
+	ErrOwnAccountChange  = errors.New("admins cannot change their own role or status")
+	ErrAdminAccountOnly  = errors.New("only admins can grant the admin role or change admin accounts")
+	ErrPrivilegedAccount = errors.New("account holds permissions the actor does not have")
+	ErrInvalidUserFilter = errors.New("invalid user filter")
+)
+
+// UserFilter filtros del listado admin de usuarios
+type UserFilter struct {
+	// Query búsqueda de texto completo en nombre y apellido (prefijos de palabra)
+	Query string
+	Rol   string
+	// Disabled filtra por estado: nil todos, true desactivados, false activos
+	Disabled      *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Sort campo de orden, con "-" delante para descendente (-created_at por defecto)
+	Sort     string
+	Page     int
+	PageSize int
+}
+
+// userSortColumns campos por los que se puede ordenar el listado
+var userSortColumns = map[string]string{
+	"created_at": "users.created_at",
+	"nombre":     "users.nombre",
+	"apellido":   "users.apellido",
+	"rol":        "users.rol",
+}
+
+// searchTermPattern caracteres que no forman parte de una palabra buscada; se
+// descartan para que la búsqueda no pueda inyectar operadores de tsquery
+var searchTermPattern = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// userSearchVector documento de búsqueda de un usuario; coincide con el índice
+// GIN que crea EnsureSearchIndex
+const userSearchVector = "to_tsvector('simple', coalesce(users.nombre, '') || ' ' || coalesce(users.apellido, ''))"
+
+// AccountService gestión de usuarios por admins: listado, cambio de rol,
+// desactivación y cierre forzado de sesiones
+type AccountService struct {
+	db          *gorm.DB
+	tokens      *TokenService
+	roles       *RoleCache
+	permissions *PermissionService
+	revocations RevocationStore
+}
+
+// NewAccountService crea el servicio de cuentas
+func NewAccountService(db *gorm.DB, tokens *TokenService, roles *RoleCache, permissions *PermissionService, revocations RevocationStore) *AccountService {
+	return &AccountService{
+		db:          db,
+		tokens:      tokens,
+		roles:       roles,
+		permissions: permissions,
+		revocations: revocations,
+	}
+}
+
+// EnsureSearchIndex crea el índice de texto completo de nombre y apellido
+func (s *AccountService) EnsureSearchIndex() error {
+	return s.db.Exec("CREATE INDEX IF NOT EXISTS idx_users_busqueda ON users USING gin (" + userSearchVector + ")").Error
+}
+
+// List usuarios que cumplen el filtro, con el email de su cuenta local, y el total
+func (s *AccountService) List(filter UserFilter) ([]models.AdminUserResponse, int64, error) {
+	query := s.db.Table("users").
+		Joins("LEFT JOIN cuentas_locales ON cuentas_locales.id_usuario = users.id")
+
+	if filter.Query != "" {
+		var prefixes []string
+		for _, term := range searchTermPattern.Split(strings.ToLower(filter.Query), -1) {
+			if term != "" {
+				prefixes = append(prefixes, term+":*")
+			}
+		}
+		if len(prefixes) == 0 {
+			return nil, 0, ErrInvalidUserFilter
+		}
+		query = query.Where(userSearchVector+" @@ to_tsquery('simple', ?)", strings.Join(prefixes, " & "))
+	}
+	if filter.Rol != "" {
+		query = query.Where("users.rol = ?", filter.Rol)
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			query = query.Where("users.desactivado_at IS NOT NULL")
+		} else {
+			query = query.Where("users.desactivado_at IS NULL")
+		}
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("users.created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("users.created_at < ?", *filter.CreatedBefore)
+	}
+
+	order, err := userOrder(filter.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	users := []models.AdminUserResponse{}
+	err = query.Select("users.*, cuentas_locales.email").
+		Order(order).
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Scan(&users).Error
+	return users, total, err
+}
+
+// userOrder traduce sort a una cláusula ORDER BY; el id desempata para que la
+// paginación sea estable
+func userOrder(sort string) (string, error) {
+	if sort == "" {
+		sort = "-created_at"
+	}
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+	column, ok := userSortColumns[sort]
+	if !ok {
+		return "", ErrInvalidUserFilter
+	}
+	return column + " " + direction + ", users.id " + direction, nil
+}
+
+// SetRole cambia users.rol. Los access tokens vigentes llevan el rol anterior,
+// así que se revocan y el cliente obtiene uno nuevo con su refresh token.
+func (s *AccountService) SetRole(actor *Principal, userID uuid.UUID, rol string) (*models.User, error) {
+	switch models.RolUsuario(rol) {
+	case models.RolCliente, models.RolTransportista, models.RolAdmin:
+	default:
+		return nil, ErrInvalidUserRole
+	}
+	if actor.UserID == userID {
+		return nil, ErrOwnAccountChange
+	}
+	if err := s.guardAdmin(actor, userID, models.RolUsuario(rol) == models.RolAdmin); err != nil {
+		return nil, err
+	}
+
+	user, err := s.update(userID, map[string]interface{}{"rol": rol})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.revocations.RevokeUserBefore(userID, time.Now()); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Deactivate desactiva la cuenta y cierra todas sus sesiones; AuthMiddleware
+// rechaza sus tokens y no puede volver a iniciar sesión hasta reactivarla
+func (s *AccountService) Deactivate(actor *Principal, userID uuid.UUID) (*models.User, error) {
+	if actor.UserID == userID {
+		return nil, ErrOwnAccountChange
+	}
+	if err := s.guardAdmin(actor, userID, false); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user, err := s.update(userID, map[string]interface{}{"desactivado_at": &now})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.forceLogout(userID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Reactivate vuelve a activar la cuenta; las sesiones cerradas no se restauran
+func (s *AccountService) Reactivate(actor *Principal, userID uuid.UUID) (*models.User, error) {
+	if err := s.guardAdmin(actor, userID, false); err != nil {
+		return nil, err
+	}
+	return s.update(userID, map[string]interface{}{"desactivado_at": nil})
+}
+
+// ForceLogout revoca todas las sesiones del usuario y sus access tokens
+// vigentes, también los de Supabase; devuelve las sesiones revocadas
+func (s *AccountService) ForceLogout(actor *Principal, userID uuid.UUID) (int64, error) {
+	if err := s.guardAdmin(actor, userID, false); err != nil {
+		return 0, err
+	}
+	return s.forceLogout(userID)
+}
+
+// forceLogout cierra las sesiones sin comprobar al actor; Deactivate ya lo hizo
+func (s *AccountService) forceLogout(userID uuid.UUID) (int64, error) {
+	revoked, err := s.tokens.RevokeUserSessions(userID, uuid.Nil, models.RevocadaDesactivada)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.revocations.RevokeUserBefore(userID, time.Now()); err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// GuardAccount comprueba que el actor pueda gestionar la cuenta del usuario,
+// con las mismas reglas que el cambio de rol o la desactivación
+func (s *AccountService) GuardAccount(actor *Principal, userID uuid.UUID) error {
+	return s.guardAdmin(actor, userID, false)
+}
+
+// guardAdmin reserva a quien tiene todos los permisos (admin) conceder el rol
+// admin y modificar cuentas admin. El resto solo puede modificar cuentas cuyos
+// permisos efectivos tiene también, así que con users:write o sessions:manage el
+// personal de soporte no puede escalar privilegios ni bloquear a un admin o a
+// un compañero con más permisos.
+func (s *AccountService) guardAdmin(actor *Principal, userID uuid.UUID, grantsAdmin bool) error {
+	if actor.HasPermission(PermAll) {
+		return nil
+	}
+	if grantsAdmin {
+		return ErrAdminAccountOnly
+	}
+
+	var user models.User
+	if err := s.db.Select("rol").First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrAccountNotFound
+		}
+		return err
+	}
+	if models.RolUsuario(user.Rol) == models.RolAdmin {
+		return ErrAdminAccountOnly
+	}
+
+	target, err := s.permissions.Resolve(userID, []string{user.Rol})
+	if err != nil {
+		return err
+	}
+	if !coversPermissions(actor, target) {
+		return ErrPrivilegedAccount
+	}
+	return nil
+}
+
+// update aplica los cambios al usuario, descarta su caché y lo devuelve actualizado
+func (s *AccountService) update(userID uuid.UUID, updates map[string]interface{}) (*models.User, error) {
+	result := s.db.Model(&models.User{}).Where("id = ?", userID).Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAccountNotFound
+	}
+
+	s.roles.Invalidate(userID)
+	s.permissions.Invalidate(userID)
+
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
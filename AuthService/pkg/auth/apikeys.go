@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Errores de claves API
+var (
+	ErrInvalidAPIKey     = errors.New("invalid api key")
+	ErrAPIKeyExpired     = errors.New("api key expired")
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrAPIKeyScopeNeeded = errors.New("at least one scope is required")
+	ErrAPIKeyPastExpiry  = errors.New("expires_at must be in the future")
+)
+
+// apiKeyPrefix identifica las claves de este servicio (p. ej. en escáneres de secretos)
+const apiKeyPrefix = "gsk_"
+
+// RateLimitError la clave superó su límite de peticiones por minuto
+type RateLimitError struct {
+	Limit      int
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "api key rate limit exceeded"
+}
+
+// APIKeyConfig configuración de las claves API
+type APIKeyConfig struct {
+	// DefaultTTL vigencia si el admin no indica expires_at (90 días por defecto)
+	DefaultTTL time.Duration
+	// DefaultRateLimit peticiones por minuto si el admin no indica límite (60 por defecto)
+	DefaultRateLimit int
+	// TouchInterval frecuencia máxima de escritura de last_used_at (1m por defecto)
+	TouchInterval time.Duration
+}
+
+// APIKeyService gestiona las claves API y autentica las peticiones que las usan.
+// El límite por minuto se cuenta en memoria, por instancia.
+type APIKeyService struct {
+	db  *gorm.DB
+	cfg APIKeyConfig
+
+	mu      sync.Mutex
+	windows map[uuid.UUID]*rateWindow
+}
+
+// rateWindow ventana fija de un minuto de una clave
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewAPIKeyService crea el servicio de claves API
+func NewAPIKeyService(db *gorm.DB, cfg APIKeyConfig) *APIKeyService {
+	if cfg.DefaultTTL <= 0 {
+		cfg.DefaultTTL = 90 * 24 * time.Hour
+	}
+	if cfg.DefaultRateLimit <= 0 {
+		cfg.DefaultRateLimit = 60
+	}
+	if cfg.TouchInterval <= 0 {
+		cfg.TouchInterval = time.Minute
+	}
+	return &APIKeyService{db: db, cfg: cfg, windows: map[uuid.UUID]*rateWindow{}}
+}
+
+// Create emite una clave y devuelve su valor completo, que no se vuelve a mostrar
+func (s *APIKeyService) Create(createdBy uuid.UUID, req models.CreateAPIKeyRequest) (*models.ClaveAPI, string, error) {
+	scopes := normalizeList(req.Scopes)
+	if len(scopes) == 0 {
+		return nil, "", ErrAPIKeyScopeNeeded
+	}
+	expiresAt := time.Now().Add(s.cfg.DefaultTTL)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, "", ErrAPIKeyPastExpiry
+		}
+		expiresAt = *req.ExpiresAt
+	}
+	limit := req.LimitePorMinuto
+	if limit <= 0 {
+		limit = s.cfg.DefaultRateLimit
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := models.ClaveAPI{
+		IDClave:         uuid.New(),
+		Prefijo:         apiKeyPrefix + id[:12],
+		SecretHash:      hashToken(secret),
+		Nombre:          strings.TrimSpace(req.Nombre),
+		Scopes:          strings.Join(scopes, " "),
+		LimitePorMinuto: limit,
+		ExpiresAt:       expiresAt,
+		CreatedBy:       createdBy,
+	}
+	if err := s.db.Create(&key).Error; err != nil {
+		return nil, "", err
+	}
+
+	return &key, key.Prefijo + "." + secret, nil
+}
+
+// List claves emitidas, la más reciente primero
+func (s *APIKeyService) List() ([]models.ClaveAPI, error) {
+	var keys []models.ClaveAPI
+	err := s.db.Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke revoca la clave; deja de aceptarse en la siguiente petición
+func (s *APIKeyService) Revoke(keyID uuid.UUID) error {
+	now := time.Now()
+	result := s.db.Model(&models.ClaveAPI{}).
+		Where("id_clave = ? AND revoked_at IS NULL", keyID).
+		Update("revoked_at", &now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate valida la clave, aplica su límite por minuto y devuelve el
+// principal de servicio con sus scopes
+func (s *APIKeyService) Authenticate(raw string) (*ServicePrincipal, error) {
+	prefix, secret, found := strings.Cut(strings.TrimSpace(raw), ".")
+	if !found || !strings.HasPrefix(prefix, apiKeyPrefix) || secret == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key models.ClaveAPI
+	if err := s.db.First(&key, "prefijo = ?", prefix).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if key.RevokedAt != nil || !hmac.Equal([]byte(hashToken(secret)), []byte(key.SecretHash)) {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if now.After(key.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	if err := s.allow(key.IDClave, key.LimitePorMinuto, now); err != nil {
+		return nil, err
+	}
+
+	// last_used_at se escribe como mucho una vez por TouchInterval
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > s.cfg.TouchInterval {
+		s.db.Model(&key).Update("last_used_at", &now)
+	}
+
+	return &ServicePrincipal{
+		ClientID: "apikey:" + key.Prefijo,
+		Scopes:   strings.Fields(key.Scopes),
+		APIKeyID: key.IDClave,
+	}, nil
+}
+
+// allow cuenta la petición en la ventana de un minuto de la clave
+func (s *APIKeyService) allow(keyID uuid.UUID, limit int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[keyID]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		w = &rateWindow{start: now}
+		s.windows[keyID] = w
+	}
+	if w.count >= limit {
+		return &RateLimitError{Limit: limit, RetryAfter: w.start.Add(time.Minute).Sub(now)}
+	}
+	w.count++
+	return nil
+}
+
+// Cleanup descarta las ventanas de límite ya cerradas
+func (s *APIKeyService) Cleanup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, w := range s.windows {
+		if now.Sub(w.start) >= time.Minute {
+			delete(s.windows, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Cleaner purga filas vencidas (revocaciones, códigos de un solo uso)
+type Cleaner interface {
+	Cleanup() error
+}
+
+// StartCleanup ejecuta c.Cleanup periódicamente hasta que ctx se cancele
+func StartCleanup(ctx context.Context, name string, c Cleaner, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.Cleanup(); err != nil {
+					log.Printf("Warning: %s cleanup failed: %v", name, err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Errores de gestión de clientes de servicio
+var (
+	ErrInvalidClientID    = errors.New("client_id must be 3-100 lowercase letters, digits, - or _")
+	ErrClientExists       = errors.New("client_id already registered")
+	ErrClientNotFound     = errors.New("service client not found")
+	ErrClientScopesNeeded = errors.New("at least one scope and one audience are required")
+)
+
+// Grant type de client credentials (RFC 6749 §4.4)
+const GrantTypeClientCredentials = "client_credentials"
+
+// clientIDPattern client_id legibles (p. ej. payments, orders-worker)
+var clientIDPattern = regexp.MustCompile(`^[a-z0-9_-]{3,100}$`)
+
+// ClientConfig configuración de los tokens de servicio
+type ClientConfig struct {
+	// Keys firman los tokens de servicio
+	Keys *KeyRing
+	// Issuer iss de los tokens de servicio
+	Issuer string
+	// TTL vida de los tokens de servicio (10m por defecto)
+	TTL time.Duration
+}
+
+// ClientService gestiona los clientes de servicio y emite sus tokens
+type ClientService struct {
+	db  *gorm.DB
+	cfg ClientConfig
+}
+
+// NewClientService crea el servicio de clientes
+func NewClientService(db *gorm.DB, cfg ClientConfig) *ClientService {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 10 * time.Minute
+	}
+	return &ClientService{db: db, cfg: cfg}
+}
+
+// ServiceVerifier verificador de los tokens de servicio dirigidos a audience
+func (s *ClientService) ServiceVerifier(audience string) *Verifier {
+	return NewVerifier(VerifierConfig{
+		Keys:     s.cfg.Keys,
+		Audience: []string{audience},
+		Issuer:   s.cfg.Issuer,
+		Leeway:   30 * time.Second,
+	})
+}
+
+// Create registra un cliente y devuelve su secreto, que no se vuelve a mostrar
+func (s *ClientService) Create(req models.CreateServiceClientRequest) (*models.ServiceClient, string, error) {
+	clientID := strings.TrimSpace(req.ClientID)
+	if !clientIDPattern.MatchString(clientID) {
+		return nil, "", ErrInvalidClientID
+	}
+	scopes, audiences := normalizeList(req.Scopes), normalizeList(req.Audiences)
+	if len(scopes) == 0 || len(audiences) == 0 {
+		return nil, "", ErrClientScopesNeeded
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := models.ServiceClient{
+		ClientID:   clientID,
+		Nombre:     strings.TrimSpace(req.Nombre),
+		SecretHash: hashToken(secret),
+		Scopes:     strings.Join(scopes, " "),
+		Audiences:  strings.Join(audiences, " "),
+		Activo:     true,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.ServiceClient{}).Where("client_id = ?", clientID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrClientExists
+		}
+		return tx.Create(&client).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &client, secret, nil
+}
+
+// List clientes registrados, activos e inactivos
+func (s *ClientService) List() ([]models.ServiceClient, error) {
+	var clients []models.ServiceClient
+	err := s.db.Order("client_id").Find(&clients).Error
+	return clients, err
+}
+
+// RotateSecret genera un secreto nuevo; el anterior deja de valer de inmediato
+func (s *ClientService) RotateSecret(clientID string) (*models.ServiceClient, string, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	result := s.db.Model(&models.ServiceClient{}).
+		Where("client_id = ?", clientID).
+		Update("secret_hash", hashToken(secret))
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, "", ErrClientNotFound
+	}
+
+	var client models.ServiceClient
+	if err := s.db.First(&client, "client_id = ?", clientID).Error; err != nil {
+		return nil, "", err
+	}
+	return &client, secret, nil
+}
+
+// Deactivate desactiva el cliente; sus tokens vigentes vencen solos (TTL corto)
+func (s *ClientService) Deactivate(clientID string) error {
+	result := s.db.Model(&models.ServiceClient{}).
+		Where("client_id = ?", clientID).
+		Update("activo", false)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+// Issue autentica al cliente y emite un token para audience con los scopes
+// pedidos; sin scope se conceden todos los permitidos
+func (s *ClientService) Issue(clientID, secret, audience, scope string) (*models.ServiceTokenResponse, error) {
+	if clientID == "" || secret == "" {
+		return nil, oauthError(OAuthInvalidClient, "client authentication required")
+	}
+
+	var client models.ServiceClient
+	err := s.db.First(&client, "client_id = ?", clientID).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	// Se compara siempre un hash para no revelar por tiempo qué clientes existen
+	stored := client.SecretHash
+	if stored == "" {
+		stored = hashToken("")
+	}
+	if err != nil || !client.Activo || !hmac.Equal([]byte(hashToken(secret)), []byte(stored)) {
+		return nil, oauthError(OAuthInvalidClient, "invalid client credentials")
+	}
+
+	audiences := strings.Fields(client.Audiences)
+	if audience == "" {
+		if len(audiences) != 1 {
+			return nil, oauthError(OAuthInvalidTarget, "audience is required")
+		}
+		audience = audiences[0]
+	}
+	if !containsString(audiences, audience) {
+		return nil, oauthError(OAuthInvalidTarget, "audience not allowed for client")
+	}
+
+	allowed := strings.Fields(client.Scopes)
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	for _, sc := range scopes {
+		if !containsString(allowed, sc) {
+			return nil, oauthError(OAuthInvalidScope, "scope "+sc+" not allowed for client")
+		}
+	}
+
+	now := time.Now()
+	granted := strings.Join(scopes, " ")
+	claims := Claims{
+		Sub:      client.ClientID,
+		Aud:      Audience{audience},
+		Iss:      s.cfg.Issuer,
+		Iat:      now.Unix(),
+		Exp:      now.Add(s.cfg.TTL).Unix(),
+		Jti:      uuid.NewString(),
+		Scope:    granted,
+		ClientID: client.ClientID,
+	}
+	token, err := s.cfg.Keys.Signer().Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	s.db.Model(&client).Update("last_used_at", &now)
+
+	return &models.ServiceTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.cfg.TTL.Seconds()),
+		Scope:       granted,
+	}, nil
+}
+
+// normalizeList quita espacios y duplicados de una lista de scopes o audiencias
+func normalizeList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, f := range strings.Fields(v) {
+			if !containsString(out, f) {
+				out = append(out, f)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// Identificadores de token exchange (RFC 8693)
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Duraciones de los tokens internos
+const (
+	defaultExchangeTokenTTL = 5 * time.Minute
+	// minExchangeTokenLifetime vida mínima útil; un subject token a punto de
+	// vencer no se canjea
+	minExchangeTokenLifetime = 10 * time.Second
+)
+
+// ExchangeConfig configuración del token exchange
+type ExchangeConfig struct {
+	// Verifier valida el subject_token igual que AuthMiddleware
+	Verifier TokenVerifier
+	// Revocations rechaza subject tokens revocados (opcional)
+	Revocations RevocationStore
+	// Sessions rechaza subject tokens propios de sesiones revocadas (opcional)
+	Sessions *TokenService
+	// Accounts rechaza subject tokens de cuentas desactivadas (opcional); Supabase
+	// sigue emitiéndoles tokens aunque aquí estén desactivadas
+	Accounts AccountChecker
+	// Keys firman los tokens internos
+	Keys *KeyRing
+	// Issuer iss de los tokens internos
+	Issuer string
+	// Audiences servicios internos y los scopes que cada uno acepta
+	Audiences map[string][]string
+	// TTL vida máxima del token interno (5m por defecto); nunca supera la del subject token
+	TTL time.Duration
+}
+
+// AccountChecker indica si la cuenta del usuario fue desactivada
+type AccountChecker interface {
+	Disabled(userID uuid.UUID) (bool, error)
+}
+
+// ExchangeService canjea tokens de usuario por tokens internos de corta duración,
+// limitados a un servicio (aud) y a scopes explícitos
+type ExchangeService struct {
+	cfg ExchangeConfig
+}
+
+// NewExchangeService crea el servicio de token exchange
+func NewExchangeService(cfg ExchangeConfig) *ExchangeService {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultExchangeTokenTTL
+	}
+	return &ExchangeService{cfg: cfg}
+}
+
+// Exchange valida el subject_token y emite un token interno para audience con los
+// scopes pedidos, que deben estar todos permitidos para ese servicio
+func (s *ExchangeService) Exchange(req models.OAuthTokenRequest) (*models.TokenExchangeResponse, error) {
+	if req.SubjectToken == "" {
+		return nil, oauthError(OAuthInvalidRequest, "subject_token is required")
+	}
+	if req.SubjectTokenType != TokenTypeAccessToken && req.SubjectTokenType != TokenTypeJWT {
+		return nil, oauthError(OAuthInvalidRequest, "subject_token_type must be access_token or jwt")
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken {
+		return nil, oauthError(OAuthInvalidRequest, "only access_token can be requested")
+	}
+
+	allowed, ok := s.cfg.Audiences[req.Audience]
+	if !ok {
+		return nil, oauthError(OAuthInvalidTarget, "unknown audience")
+	}
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		return nil, oauthError(OAuthInvalidScope, "scope is required")
+	}
+	for _, scope := range scopes {
+		if !containsString(allowed, scope) {
+			return nil, oauthError(OAuthInvalidScope, "scope "+scope+" not allowed for "+req.Audience)
+		}
+	}
+
+	subject, err := s.verifySubject(req.SubjectToken)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	exp := now.Add(s.cfg.TTL)
+	if subjectExp := time.Unix(subject.Exp, 0); subjectExp.Before(exp) {
+		exp = subjectExp
+	}
+	if exp.Sub(now) < minExchangeTokenLifetime {
+		return nil, oauthError(OAuthInvalidGrant, "subject_token is about to expire")
+	}
+
+	scope := strings.Join(scopes, " ")
+	claims := Claims{
+		Sub:       subject.Sub,
+		Aud:       Audience{req.Audience},
+		Iss:       s.cfg.Issuer,
+		Iat:       now.Unix(),
+		Exp:       exp.Unix(),
+		Jti:       uuid.NewString(),
+		SessionID: subject.SessionID,
+		Amr:       subject.Amr,
+		Aal:       subject.Aal,
+		Scope:     scope,
+		// Una suplantación sigue identificando al admin en los demás servicios
+		Act:      subject.Act,
+		ImpWrite: subject.ImpWrite,
+	}
+	token, err := s.cfg.Keys.Signer().Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenExchangeResponse{
+		AccessToken:     token,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(exp.Sub(now).Seconds()),
+		Scope:           scope,
+	}, nil
+}
+
+// verifySubject aplica al subject_token las mismas comprobaciones que
+// AuthMiddleware: firma y claims, revocaciones, sesión y cuenta desactivada
+func (s *ExchangeService) verifySubject(token string) (*Claims, error) {
+	claims, err := s.cfg.Verifier.Verify(token)
+	if err != nil {
+		return nil, oauthError(OAuthInvalidGrant, "invalid subject_token: "+err.Error())
+	}
+	userID, err := uuid.Parse(claims.Sub)
+	if err != nil {
+		return nil, oauthError(OAuthInvalidGrant, "invalid subject_token: invalid subject")
+	}
+
+	if s.cfg.Revocations != nil {
+		revoked, err := s.cfg.Revocations.IsRevoked(claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, oauthError(OAuthInvalidGrant, "subject_token revoked")
+		}
+	}
+	if s.cfg.Sessions != nil {
+		if err := s.cfg.Sessions.ValidateSession(claims); err != nil {
+			if err == ErrSessionRevoked {
+				return nil, oauthError(OAuthInvalidGrant, "subject_token session revoked")
+			}
+			return nil, err
+		}
+	}
+	if s.cfg.Accounts != nil {
+		disabled, err := s.cfg.Accounts.Disabled(userID)
+		if err != nil {
+			return nil, err
+		}
+		if disabled {
+			return nil, oauthError(OAuthInvalidGrant, "account disabled")
+		}
+	}
+
+	return claims, nil
+}
+
+// containsString indica si list incluye value
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
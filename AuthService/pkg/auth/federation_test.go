@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testRedirectURL = "https://app.example.com/auth/callback"
+
+// fakeIssuer proveedor OIDC mínimo en 127.0.0.1: discovery, JWKS y token endpoint
+type fakeIssuer struct {
+	t      *testing.T
+	srv    *httptest.Server
+	signer *Signer
+
+	// discoveryHits peticiones recibidas en el discovery
+	discoveryHits atomic.Int32
+	// discoveryStatus código que devuelve el discovery (200 por defecto)
+	discoveryStatus atomic.Int32
+	// discoveryGate si no es nil, el discovery avisa en entered y espera a release
+	discoveryGate *gate
+	// issuerOverride issuer anunciado en el discovery en lugar del real
+	issuerOverride string
+
+	mu sync.Mutex
+	// tokenStatus código que devuelve el token endpoint (200 por defecto)
+	tokenStatus int
+	// idToken claims del id_token que emite el token endpoint
+	idToken map[string]interface{}
+	// lastToken formulario y credenciales recibidos en el token endpoint
+	lastToken  map[string]string
+	lastClient [2]string
+}
+
+type gate struct {
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	signer, err := GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIssuer{t: t, signer: signer, tokenStatus: http.StatusOK}
+	f.discoveryStatus.Store(http.StatusOK)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", f.discovery)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, JWKSDocument{Keys: []JWK{f.signer.JWK()}})
+	})
+	mux.HandleFunc("/token", f.token)
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	f.discoveryHits.Add(1)
+	if g := f.discoveryGate; g != nil {
+		g.once.Do(func() { close(g.entered) })
+		<-g.release
+	}
+	if status := int(f.discoveryStatus.Load()); status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+	issuer := f.srv.URL
+	if f.issuerOverride != "" {
+		issuer = f.issuerOverride
+	}
+	writeJSON(w, map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": f.srv.URL + "/authorize",
+		"token_endpoint":         f.srv.URL + "/token",
+		"jwks_uri":               f.srv.URL + "/jwks",
+	})
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.lastToken = map[string]string{}
+	for k := range r.PostForm {
+		f.lastToken[k] = r.PostForm.Get(k)
+	}
+	user, pass, _ := r.BasicAuth()
+	f.lastClient = [2]string{user, pass}
+
+	if f.tokenStatus != http.StatusOK {
+		w.WriteHeader(f.tokenStatus)
+		return
+	}
+	idToken, err := f.signer.Sign(f.idToken)
+	if err != nil {
+		f.t.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestFederation(t *testing.T, issuers map[string]*fakeIssuer) *FederationService {
+	t.Helper()
+	var providers []FederationProvider
+	for id, f := range issuers {
+		providers = append(providers, FederationProvider{
+			ID:           id,
+			Issuer:       f.srv.URL,
+			ClientID:     id + "-client",
+			ClientSecret: id + "-secret",
+		})
+	}
+	s, err := NewFederationService(nil, FederationConfig{
+		Providers:   providers,
+		RedirectURL: testRedirectURL,
+		HTTPClient:  &http.Client{Timeout: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestValidateIssuerURL(t *testing.T) {
+	tests := []struct {
+		issuer string
+		ok     bool
+	}{
+		{"https://accounts.example.com", true},
+		{"http://127.0.0.1:8080", true},
+		{"http://localhost:8080", true},
+		{"http://[::1]:8080", true},
+		{"http://accounts.example.com", false},
+		{"http://10.0.0.1", false},
+		{"accounts.example.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := validateIssuerURL(tt.issuer); (err == nil) != tt.ok {
+			t.Errorf("validateIssuerURL(%q) = %v, want ok=%v", tt.issuer, err, tt.ok)
+		}
+	}
+}
+
+func TestFederationDiscoveryAndCodeExchange(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	s := newTestFederation(t, map[string]*fakeIssuer{"acme": issuer})
+	p, err := s.provider("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote, err := s.remote(p)
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+	if remote.tokenEndpoint != issuer.srv.URL+"/token" || remote.authorizationEndpoint != issuer.srv.URL+"/authorize" {
+		t.Fatalf("unexpected endpoints: %+v", remote)
+	}
+	if again, err := s.remote(p); err != nil || again != remote || issuer.discoveryHits.Load() != 1 {
+		t.Fatalf("discovery should be cached, got %d requests", issuer.discoveryHits.Load())
+	}
+
+	now := time.Now().Unix()
+	issuer.idToken = map[string]interface{}{
+		"iss":            issuer.srv.URL,
+		"aud":            "acme-client",
+		"sub":            "user-123",
+		"nonce":          "n-0S6",
+		"email":          "Ana@Example.com",
+		"email_verified": "true",
+		"iat":            now,
+		"exp":            now + 300,
+	}
+	idToken, err := s.exchangeCode(p, remote, "code-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("code exchange: %v", err)
+	}
+
+	want := map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          "code-1",
+		"redirect_uri":  testRedirectURL,
+		"code_verifier": "verifier-1",
+	}
+	for k, v := range want {
+		if issuer.lastToken[k] != v {
+			t.Errorf("token request %s = %q, want %q", k, issuer.lastToken[k], v)
+		}
+	}
+	if issuer.lastClient != [2]string{"acme-client", "acme-secret"} {
+		t.Errorf("token request client = %v, want client_secret_basic", issuer.lastClient)
+	}
+
+	var claims federatedClaims
+	if err := remote.verifier.VerifyInto(idToken, &claims); err != nil {
+		t.Fatalf("id_token: %v", err)
+	}
+	if claims.Sub != "user-123" || claims.Nonce != "n-0S6" || !bool(claims.EmailVerified) {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	// Un id_token emitido para otro cliente no se acepta
+	issuer.idToken["aud"] = "other-client"
+	idToken, err = s.exchangeCode(p, remote, "code-2", "verifier-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.verifier.VerifyInto(idToken, &claims); err == nil {
+		t.Fatal("id_token for another audience must be rejected")
+	}
+}
+
+func TestFederationTokenEndpointErrors(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	s := newTestFederation(t, map[string]*fakeIssuer{"acme": issuer})
+	p, _ := s.provider("acme")
+	remote, err := s.remote(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusBadRequest, ErrFederationFailed},
+		{http.StatusUnauthorized, ErrFederationFailed},
+		{http.StatusServiceUnavailable, ErrProviderUnavailable},
+	}
+	for _, tt := range tests {
+		issuer.mu.Lock()
+		issuer.tokenStatus = tt.status
+		issuer.mu.Unlock()
+		if _, err := s.exchangeCode(p, remote, "code", "verifier"); !errors.Is(err, tt.want) {
+			t.Errorf("status %d: got %v, want %v", tt.status, err, tt.want)
+		}
+	}
+}
+
+func TestFederationDiscoveryFailures(t *testing.T) {
+	t.Run("failures are retried", func(t *testing.T) {
+		issuer := newFakeIssuer(t)
+		issuer.discoveryStatus.Store(http.StatusBadGateway)
+		s := newTestFederation(t, map[string]*fakeIssuer{"acme": issuer})
+		p, _ := s.provider("acme")
+
+		if _, err := s.remote(p); !errors.Is(err, ErrProviderUnavailable) {
+			t.Fatalf("got %v, want ErrProviderUnavailable", err)
+		}
+		issuer.discoveryStatus.Store(http.StatusOK)
+		if _, err := s.remote(p); err != nil {
+			t.Fatalf("discovery should be retried after a failure: %v", err)
+		}
+		if hits := issuer.discoveryHits.Load(); hits != 2 {
+			t.Fatalf("discovery requests = %d, want 2", hits)
+		}
+	})
+
+	t.Run("issuer mismatch", func(t *testing.T) {
+		issuer := newFakeIssuer(t)
+		issuer.issuerOverride = "https://evil.example.com"
+		s := newTestFederation(t, map[string]*fakeIssuer{"acme": issuer})
+		p, _ := s.provider("acme")
+
+		if _, err := s.remote(p); !errors.Is(err, ErrProviderUnavailable) {
+			t.Fatalf("got %v, want ErrProviderUnavailable", err)
+		}
+	})
+}
+
+func TestFederationSlowProviderDoesNotBlockOthers(t *testing.T) {
+	slow := newFakeIssuer(t)
+	slow.discoveryGate = &gate{entered: make(chan struct{}), release: make(chan struct{})}
+	fast := newFakeIssuer(t)
+	s := newTestFederation(t, map[string]*fakeIssuer{"slow": slow, "fast": fast})
+	slowProvider, _ := s.provider("slow")
+	fastProvider, _ := s.provider("fast")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.remote(slowProvider)
+			errs <- err
+		}()
+	}
+	defer close(slow.discoveryGate.release)
+
+	select {
+	case <-slow.discoveryGate.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow discovery never started")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.remote(fastProvider)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("fast provider: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("a slow provider blocked discovery of another provider")
+	}
+
+	// Las peticiones simultáneas al proveedor lento comparten una única carga
+	time.Sleep(50 * time.Millisecond)
+	slow.discoveryGate.release <- struct{}{}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("slow provider: %v", err)
+		}
+	}
+	if hits := slow.discoveryHits.Load(); hits != 1 {
+		t.Fatalf("slow discovery requests = %d, want 1", hits)
+	}
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+	"goServices/pkg/notify"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewDeviceNotifier avisa al usuario de un login desde un dispositivo no visto
+type NewDeviceNotifier interface {
+	NotifyNewDevice(ctx context.Context, user *models.User, login models.RegistroLogin) error
+}
+
+// LoginHistoryConfig configuración del historial de logins
+type LoginHistoryConfig struct {
+	// Notifier avisa de dispositivos nuevos (opcional)
+	Notifier NewDeviceNotifier
+	// Retention antigüedad máxima de los registros (90 días por defecto)
+	Retention time.Duration
+}
+
+// LoginHistoryService registra los intentos de autenticación y detecta
+// dispositivos nuevos por su huella
+type LoginHistoryService struct {
+	db  *gorm.DB
+	cfg LoginHistoryConfig
+}
+
+// NewLoginHistoryService crea el servicio de historial
+func NewLoginHistoryService(db *gorm.DB, cfg LoginHistoryConfig) *LoginHistoryService {
+	if cfg.Retention <= 0 {
+		cfg.Retention = 90 * 24 * time.Hour
+	}
+	return &LoginHistoryService{db: db, cfg: cfg}
+}
+
+// DeviceFingerprint huella del dispositivo: el X-Device-ID del cliente si lo
+// envía, si no el user agent
+func DeviceFingerprint(device models.DeviceInfo) string {
+	if id := strings.TrimSpace(device.DeviceID); id != "" {
+		return hashToken("id:" + id)
+	}
+	return hashToken("ua:" + strings.ToLower(strings.TrimSpace(device.UserAgent)))
+}
+
+// RecordLogin registra un login exitoso y avisa si el dispositivo es nuevo. El
+// primer dispositivo de un usuario no genera aviso. Los errores solo se registran
+// en el log: el login no falla por el historial.
+func (s *LoginHistoryService) RecordLogin(user *models.User, sessionID uuid.UUID, device models.DeviceInfo, amr []string) {
+	now := time.Now()
+	fingerprint := DeviceFingerprint(device)
+
+	isNew, err := s.touchDevice(user.ID, fingerprint, device, now)
+	if err != nil {
+		log.Printf("Warning: failed to record device for user %s: %v", user.ID, err)
+	}
+
+	userID := user.ID
+	entry := models.RegistroLogin{
+		IDRegistro:       uuid.New(),
+		IDUsuario:        &userID,
+		Exito:            true,
+		Metodo:           strings.Join(amr, ","),
+		IP:               device.IP,
+		UserAgent:        device.UserAgent,
+		Dispositivo:      device.Dispositivo,
+		Huella:           fingerprint,
+		DispositivoNuevo: isNew,
+		IDSesion:         &sessionID,
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		log.Printf("Warning: failed to record login for user %s: %v", user.ID, err)
+	}
+
+	if isNew && s.cfg.Notifier != nil {
+		if err := s.cfg.Notifier.NotifyNewDevice(context.Background(), user, entry); err != nil {
+			log.Printf("Warning: failed to notify new device for user %s: %v", user.ID, err)
+		}
+	}
+}
+
+// touchDevice guarda el dispositivo y devuelve true si es nuevo y el usuario ya
+// tenía otros
+func (s *LoginHistoryService) touchDevice(userID uuid.UUID, fingerprint string, device models.DeviceInfo, now time.Time) (bool, error) {
+	known := models.DispositivoConocido{
+		IDUsuario:   userID,
+		Huella:      fingerprint,
+		UserAgent:   device.UserAgent,
+		IP:          device.IP,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&known)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, s.db.Model(&models.DispositivoConocido{}).
+			Where("id_usuario = ? AND huella = ?", userID, fingerprint).
+			Updates(map[string]interface{}{"last_seen_at": now, "ip": device.IP}).Error
+	}
+
+	var others int64
+	if err := s.db.Model(&models.DispositivoConocido{}).
+		Where("id_usuario = ? AND huella <> ?", userID, fingerprint).
+		Count(&others).Error; err != nil {
+		return false, err
+	}
+	return others > 0, nil
+}
+
+// RecordFailure registra un intento fallido contra una clave de cuenta
+// (auth.AccountKey); sin cuenta conocida se guarda sin usuario
+func (s *LoginHistoryService) RecordFailure(account, method string, device models.DeviceInfo) error {
+	entry := models.RegistroLogin{
+		IDRegistro:  uuid.New(),
+		Exito:       false,
+		Metodo:      method,
+		IP:          device.IP,
+		UserAgent:   device.UserAgent,
+		Dispositivo: device.Dispositivo,
+		Huella:      DeviceFingerprint(device),
+	}
+	if userID, ok := s.resolveAccount(account); ok {
+		entry.IDUsuario = &userID
+	}
+	return s.db.Create(&entry).Error
+}
+
+// resolveAccount usuario de una clave de cuenta, si existe
+func (s *LoginHistoryService) resolveAccount(account string) (uuid.UUID, bool) {
+	kind, value, found := strings.Cut(account, ":")
+	if !found || value == "" {
+		return uuid.Nil, false
+	}
+
+	switch kind {
+	case "user":
+		userID, err := uuid.Parse(value)
+		return userID, err == nil
+	case "email":
+		var cuenta models.CuentaLocal
+		if err := s.db.Select("id_usuario").First(&cuenta, "email = ?", value).Error; err == nil {
+			return cuenta.IDUsuario, true
+		}
+	case "phone":
+		var perfiles []models.PerfilCliente
+		if err := s.db.Select("id_usuario").Where("telefono = ?", value).Limit(2).Find(&perfiles).Error; err == nil && len(perfiles) == 1 {
+			return perfiles[0].IDUsuario, true
+		}
+	}
+	return uuid.Nil, false
+}
+
+// List historial del usuario, el más reciente primero, y el total
+func (s *LoginHistoryService) List(userID uuid.UUID, page, pageSize int) ([]models.RegistroLogin, int64, error) {
+	query := s.db.Model(&models.RegistroLogin{}).Where("id_usuario = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []models.RegistroLogin
+	err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&entries).Error
+	return entries, total, err
+}
+
+// Cleanup borra los registros más antiguos que la retención
+func (s *LoginHistoryService) Cleanup() error {
+	return s.db.Where("created_at < ?", time.Now().Add(-s.cfg.Retention)).Delete(&models.RegistroLogin{}).Error
+}
+
+// EmailDeviceNotifier avisa por email (outbox) al email de la cuenta local
+type EmailDeviceNotifier struct {
+	db     *gorm.DB
+	sender notify.Sender
+}
+
+// NewEmailDeviceNotifier crea el aviso por email
+func NewEmailDeviceNotifier(db *gorm.DB, sender notify.Sender) *EmailDeviceNotifier {
+	return &EmailDeviceNotifier{db: db, sender: sender}
+}
+
+// NotifyNewDevice envía el aviso; usuarios sin cuenta local no reciben email
+func (n *EmailDeviceNotifier) NotifyNewDevice(ctx context.Context, user *models.User, login models.RegistroLogin) error {
+	var cuenta models.CuentaLocal
+	if err := n.db.Select("email").First(&cuenta, "id_usuario = ?", user.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	device := login.UserAgent
+	if login.Dispositivo != "" {
+		device = login.Dispositivo
+	}
+	return n.sender.Send(ctx, notify.Message{
+		Channel: notify.ChannelEmail,
+		To:      cuenta.Email,
+		Subject: "Nuevo inicio de sesión en tu cuenta",
+		Body: fmt.Sprintf(
+			"Se inició sesión en tu cuenta desde un dispositivo nuevo (%s, IP %s) el %s. Si no fuiste tú, cambia tu contraseña y cierra tus sesiones.",
+			device, login.IP, login.CreatedAt.Format("02/01/2006 15:04 MST"),
+		),
+	})
+}
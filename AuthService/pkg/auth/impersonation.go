@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Errores de suplantación
+var (
+	ErrImpersonationReason   = errors.New("motivo is required")
+	ErrImpersonateSelf       = errors.New("cannot impersonate yourself")
+	ErrImpersonateAdmin      = errors.New("admins cannot be impersonated")
+	ErrImpersonateStaff      = errors.New("users with custom roles cannot be impersonated")
+	ErrImpersonationChain    = errors.New("cannot impersonate while impersonating")
+	ErrImpersonationNotFound = errors.New("user not found")
+)
+
+// AMRImpersonation sesión abierta por un admin en nombre del usuario
+const AMRImpersonation = "imp"
+
+// ImpersonationService emite tokens de suplantación y guarda su auditoría.
+// Cada suplantación abre una sesión propia del usuario, visible en su lista de
+// sesiones y revocable, sin refresh token.
+type ImpersonationService struct {
+	db     *gorm.DB
+	tokens *TokenService
+	ttl    time.Duration
+}
+
+// NewImpersonationService crea el servicio; ttl vida del token (15m por
+// defecto, 1h como máximo)
+func NewImpersonationService(db *gorm.DB, tokens *TokenService, ttl time.Duration) *ImpersonationService {
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	if ttl > time.Hour {
+		ttl = time.Hour
+	}
+	return &ImpersonationService{db: db, tokens: tokens, ttl: ttl}
+}
+
+// Start abre una sesión del usuario a nombre del admin y emite el token con act
+func (s *ImpersonationService) Start(actor *Principal, userID uuid.UUID, req models.ImpersonateRequest, device models.DeviceInfo) (*models.ImpersonationResponse, error) {
+	motivo := strings.TrimSpace(req.Motivo)
+	if motivo == "" {
+		return nil, ErrImpersonationReason
+	}
+	if actor.IsImpersonated() {
+		return nil, ErrImpersonationChain
+	}
+	if actor.UserID == userID {
+		return nil, ErrImpersonateSelf
+	}
+
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrImpersonationNotFound
+		}
+		return nil, err
+	}
+	// Solo clientes y transportistas sin roles personalizados: suplantar a alguien
+	// del personal daría sus permisos bajo su identidad
+	switch models.RolUsuario(user.Rol) {
+	case models.RolCliente, models.RolTransportista:
+	default:
+		return nil, ErrImpersonateAdmin
+	}
+	var assigned int64
+	if err := s.db.Model(&models.UsuarioRol{}).Where("id_usuario = ?", userID).Count(&assigned).Error; err != nil {
+		return nil, err
+	}
+	if assigned > 0 {
+		return nil, ErrImpersonateStaff
+	}
+
+	var cuenta models.CuentaLocal
+	if err := s.db.Select("email").First(&cuenta, "id_usuario = ?", userID).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	now := time.Now()
+	actorID := actor.UserID
+	session := models.Session{
+		IDSesion:      uuid.New(),
+		IDUsuario:     user.ID,
+		Dispositivo:   "Suplantación",
+		UserAgent:     device.UserAgent,
+		IP:            device.IP,
+		LastUsedAt:    now,
+		ExpiresAt:     now.Add(s.ttl),
+		AMR:           AMRImpersonation,
+		SuplantadoPor: &actorID,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuditoriaSuplantacion{
+			IDRegistro: uuid.New(),
+			IDActor:    actorID,
+			IDUsuario:  user.ID,
+			IDSesion:   session.IDSesion,
+			Evento:     models.EventoSuplantacionInicio,
+			Motivo:     motivo,
+			IP:         device.IP,
+			UserAgent:  device.UserAgent,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// El nivel de autenticación es el del admin, no el del usuario
+	aal := AAL1
+	if actor.HasMFA() {
+		aal = AAL2
+	}
+	claims := Claims{
+		Sub:         user.ID.String(),
+		Aud:         Audience{s.tokens.cfg.Audience},
+		Iss:         s.tokens.cfg.Issuer,
+		Iat:         now.Unix(),
+		Exp:         session.ExpiresAt.Unix(),
+		Jti:         uuid.NewString(),
+		Role:        "authenticated",
+		Email:       cuenta.Email,
+		SessionID:   session.IDSesion.String(),
+		Amr:         AMR{AMRImpersonation},
+		Aal:         aal,
+		AppMetadata: map[string]interface{}{"rol": user.Rol},
+		Act:         &ActorClaim{Sub: actorID.String(), Email: actor.Email},
+		ImpWrite:    req.PermitirEscritura,
+	}
+	token, err := s.tokens.cfg.Keys.Signer().Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ImpersonationResponse{
+		AccessToken:       token,
+		TokenType:         "Bearer",
+		ExpiresIn:         int64(s.ttl.Seconds()),
+		SessionID:         session.IDSesion.String(),
+		IDUsuario:         user.ID,
+		SuplantadoPor:     actorID,
+		PermitirEscritura: req.PermitirEscritura,
+	}, nil
+}
+
+// Record guarda una petición hecha con un token de suplantación
+func (s *ImpersonationService) Record(entry models.AuditoriaSuplantacion) error {
+	if entry.IDRegistro == uuid.Nil {
+		entry.IDRegistro = uuid.New()
+	}
+	return s.db.Create(&entry).Error
+}
+
+// ImpersonationFilter filtros del listado de auditoría
+type ImpersonationFilter struct {
+	ActorID  *uuid.UUID
+	UserID   *uuid.UUID
+	Page     int
+	PageSize int
+}
+
+// List registros de auditoría, el más reciente primero, y el total
+func (s *ImpersonationService) List(filter ImpersonationFilter) ([]models.AuditoriaSuplantacion, int64, error) {
+	query := s.db.Model(&models.AuditoriaSuplantacion{})
+	if filter.ActorID != nil {
+		query = query.Where("id_actor = ?", *filter.ActorID)
+	}
+	if filter.UserID != nil {
+		query = query.Where("id_usuario = ?", *filter.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []models.AuditoriaSuplantacion
+	err := query.Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&entries).Error
+	return entries, total, err
+}
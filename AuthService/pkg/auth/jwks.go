@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+)
+
+// JWK clave pública en formato JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSDocument documento JWKS ({"keys": [...]})
+type JWKSDocument struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet conjunto estático de claves indexadas por kid
+type KeySet struct {
+	keys map[string]crypto.PublicKey
+}
+
+// ParseJWKS construye un KeySet a partir de un documento JWKS
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc JWKSDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS document: %w", err)
+	}
+
+	set := &KeySet{keys: make(map[string]crypto.PublicKey, len(doc.Keys))}
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// Ignorar claves de tipos no soportados sin invalidar el documento
+			continue
+		}
+		set.keys[jwk.Kid] = key
+	}
+
+	return set, nil
+}
+
+// readJWKS valida la respuesta HTTP y parsea su cuerpo como JWKS
+func readJWKS(resp *http.Response) (*KeySet, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+
+	return ParseJWKS(data)
+}
+
+// LookupKey devuelve la clave con el kid dado
+func (s *KeySet) LookupKey(kid string) (crypto.PublicKey, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// Len número de claves cargadas
+func (s *KeySet) Len() int {
+	return len(s.keys)
+}
+
+// PublicKey convierte la JWK en una clave pública de crypto
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x: %w", err)
+		}
+		y, err := decodeSegment(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,454 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Errores de verificación; el middleware los traduce a códigos distintos
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotYetValid = errors.New("token not yet valid")
+	ErrInvalidAudience  = errors.New("invalid token audience")
+	ErrInvalidIssuer    = errors.New("invalid token issuer")
+)
+
+// Algoritmos de firma soportados
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// Audience acepta el claim aud como string o como arreglo de strings
+type Audience []string
+
+// UnmarshalJSON decodifica aud en cualquiera de sus dos formas
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// MarshalJSON serializa aud como string cuando tiene un solo valor
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Contains indica si la audiencia incluye el valor dado
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// Niveles de autenticación (aal)
+const (
+	AAL1 = "aal1"
+	AAL2 = "aal2"
+)
+
+// Métodos de autenticación (amr)
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+	AMRTOTP     = "totp"
+	AMRRecovery = "recovery"
+	// AMRMagicLink enlace mágico enviado por email
+	AMRMagicLink = "magiclink"
+	// AMRSMS código enviado por SMS
+	AMRSMS = "sms"
+	// AMRHardwareKey prueba de posesión de una clave (passkey WebAuthn)
+	AMRHardwareKey = "hwk"
+	// AMRUserVerified el autenticador verificó al usuario (PIN o biometría)
+	AMRUserVerified = "user"
+)
+
+// AMR métodos de autenticación; acepta strings (RFC 8176) u objetos
+// {"method": ..., "timestamp": ...} como los emite Supabase
+type AMR []string
+
+// UnmarshalJSON decodifica amr en cualquiera de sus dos formas
+func (a *AMR) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	methods := make(AMR, 0, len(raw))
+	for _, item := range raw {
+		var method string
+		if err := json.Unmarshal(item, &method); err == nil {
+			methods = append(methods, method)
+			continue
+		}
+		var entry struct {
+			Method string `json:"method"`
+		}
+		if err := json.Unmarshal(item, &entry); err != nil {
+			return err
+		}
+		methods = append(methods, entry.Method)
+	}
+	*a = methods
+	return nil
+}
+
+// Contains indica si se usó el método dado
+func (a AMR) Contains(method string) bool {
+	for _, m := range a {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims estructura del JWT de Supabase
+type Claims struct {
+	Sub          string                 `json:"sub"`
+	Aud          Audience               `json:"aud,omitempty"`
+	Iss          string                 `json:"iss,omitempty"`
+	Iat          int64                  `json:"iat,omitempty"`
+	Nbf          int64                  `json:"nbf,omitempty"`
+	Exp          int64                  `json:"exp"`
+	Jti          string                 `json:"jti,omitempty"`
+	Role         string                 `json:"role,omitempty"`
+	Email        string                 `json:"email,omitempty"`
+	Phone        string                 `json:"phone,omitempty"`
+	SessionID    string                 `json:"session_id,omitempty"`
+	Amr          AMR                    `json:"amr,omitempty"`
+	Aal          string                 `json:"aal,omitempty"`
+	AppMetadata  map[string]interface{} `json:"app_metadata,omitempty"`
+	UserMetadata map[string]interface{} `json:"user_metadata,omitempty"`
+	// Scope scopes separados por espacios de los tokens internos (token exchange)
+	Scope string `json:"scope,omitempty"`
+	// ClientID servicio que obtuvo el token con client credentials (RFC 9068)
+	ClientID string `json:"client_id,omitempty"`
+	// Act admin que actúa en nombre de sub en un token de suplantación (RFC 8693 §4.1)
+	Act *ActorClaim `json:"act,omitempty"`
+	// ImpWrite la suplantación admite acciones de escritura
+	ImpWrite bool `json:"imp_write,omitempty"`
+
+	// Raw payload completo, incluidos claims no tipados
+	Raw map[string]interface{} `json:"-"`
+}
+
+// ActorClaim identidad de quien actúa en nombre del sujeto
+type ActorClaim struct {
+	Sub   string `json:"sub"`
+	Email string `json:"email,omitempty"`
+}
+
+// header cabecera JOSE del token
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// TokenVerifier valida un token y devuelve sus claims
+type TokenVerifier interface {
+	Verify(token string) (*Claims, error)
+}
+
+// KeySource resuelve la clave pública asociada a un kid
+type KeySource interface {
+	LookupKey(kid string) (crypto.PublicKey, error)
+}
+
+// VerifierConfig configuración del verificador de tokens
+type VerifierConfig struct {
+	// HMACSecret secreto compartido para HS256 (JWT secret de Supabase)
+	HMACSecret []byte
+	// Keys fuente de claves públicas para RS256/ES256
+	Keys KeySource
+	// Audience audiencias aceptadas; vacío desactiva la validación
+	Audience []string
+	// Issuer emisor esperado; vacío desactiva la validación
+	Issuer string
+	// Leeway tolerancia de reloj para exp/nbf
+	Leeway time.Duration
+	// Now reloj inyectable, por defecto time.Now
+	Now func() time.Time
+}
+
+// Verifier valida firma y claims registrados de un JWT
+type Verifier struct {
+	cfg VerifierConfig
+}
+
+// NewVerifier crea un verificador con la configuración dada
+func NewVerifier(cfg VerifierConfig) *Verifier {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Verifier{cfg: cfg}
+}
+
+// Verify valida el token y devuelve sus claims
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	payload, err := v.verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	if err := json.Unmarshal(payload, &claims.Raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	return &claims, nil
+}
+
+// Issuer emisor que este verificador acepta
+func (v *Verifier) Issuer() string {
+	return v.cfg.Issuer
+}
+
+// VerifyInto valida firma y claims registrados, y decodifica el payload en dst
+func (v *Verifier) VerifyInto(token string, dst interface{}) error {
+	payload, err := v.verify(token)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(payload, dst); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	return nil
+}
+
+// verify comprueba firma y claims registrados y devuelve el payload
+func (v *Verifier) verify(token string) ([]byte, error) {
+	payload, err := v.verifySignature(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var registered Claims
+	if err := json.Unmarshal(payload, &registered); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	if err := v.validateClaims(&registered); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// MultiVerifier elige el verificador según el iss del token, de modo que
+// conviven tokens de Supabase y tokens emitidos por este servicio
+type MultiVerifier struct {
+	verifiers []*Verifier
+}
+
+// NewMultiVerifier combina verificadores; los nil se ignoran. Un verificador
+// sin Issuer configurado actúa como respaldo para cualquier iss.
+func NewMultiVerifier(verifiers ...*Verifier) *MultiVerifier {
+	m := &MultiVerifier{}
+	for _, v := range verifiers {
+		if v != nil {
+			m.verifiers = append(m.verifiers, v)
+		}
+	}
+	return m
+}
+
+// Verify despacha al verificador del emisor del token
+func (m *MultiVerifier) Verify(token string) (*Claims, error) {
+	iss, err := peekIssuer(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var fallback *Verifier
+	for _, v := range m.verifiers {
+		if v.Issuer() == iss {
+			return v.Verify(token)
+		}
+		if v.Issuer() == "" && fallback == nil {
+			fallback = v
+		}
+	}
+
+	if fallback == nil {
+		return nil, ErrInvalidIssuer
+	}
+	return fallback.Verify(token)
+}
+
+// peekIssuer lee el iss sin verificar; solo sirve para elegir el verificador
+func peekIssuer(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrMalformedToken
+	}
+	payload, err := decodeSegment(parts[1])
+	if err != nil {
+		return "", ErrMalformedToken
+	}
+
+	var claims struct {
+		Iss string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", ErrMalformedToken
+	}
+	return claims.Iss, nil
+}
+
+// verifySignature comprueba la firma y devuelve el payload decodificado
+func (v *Verifier) verifySignature(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	rawHeader, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var hdr header
+	if err := json.Unmarshal(rawHeader, &hdr); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+
+	switch hdr.Alg {
+	case AlgHS256:
+		if len(v.cfg.HMACSecret) == 0 {
+			return nil, ErrUnsupportedAlg
+		}
+		mac := hmac.New(sha256.New, v.cfg.HMACSecret)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, ErrInvalidSignature
+		}
+	case AlgRS256, AlgES256:
+		if v.cfg.Keys == nil {
+			return nil, ErrUnsupportedAlg
+		}
+		key, err := v.cfg.Keys.LookupKey(hdr.Kid)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyAsymmetric(hdr.Alg, key, signingInput, signature); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+
+	payload, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	return payload, nil
+}
+
+// validateClaims valida exp, nbf, aud e iss
+func (v *Verifier) validateClaims(claims *Claims) error {
+	now := v.cfg.Now()
+
+	if claims.Exp == 0 || now.After(time.Unix(claims.Exp, 0).Add(v.cfg.Leeway)) {
+		return ErrTokenExpired
+	}
+	if claims.Nbf != 0 && now.Add(v.cfg.Leeway).Before(time.Unix(claims.Nbf, 0)) {
+		return ErrTokenNotYetValid
+	}
+
+	if len(v.cfg.Audience) > 0 {
+		matched := false
+		for _, aud := range v.cfg.Audience {
+			if claims.Aud.Contains(aud) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return ErrInvalidAudience
+		}
+	}
+
+	if v.cfg.Issuer != "" && claims.Iss != v.cfg.Issuer {
+		return ErrInvalidIssuer
+	}
+
+	return nil
+}
+
+// verifyAsymmetric verifica firmas RS256 y ES256 contra la clave pública
+func verifyAsymmetric(alg string, key crypto.PublicKey, signingInput, signature []byte) error {
+	digest := sha256.Sum256(signingInput)
+
+	switch alg {
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedAlg
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve.Params().BitSize != 256 {
+			return ErrUnsupportedAlg
+		}
+		// JWS codifica la firma ECDSA como r||s de tamaño fijo
+		if len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlg
+	}
+
+	return nil
+}
+
+// decodeSegment decodifica un segmento base64 URL-safe con o sin padding
+func decodeSegment(seg string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(seg, "="))
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// JWKSSource origen de un documento JWKS
+type JWKSSource interface {
+	Load(ctx context.Context) (*KeySet, error)
+}
+
+// URLSource obtiene el JWKS desde una URL
+type URLSource struct {
+	URL    string
+	Client *http.Client
+}
+
+// Load descarga el JWKS de la URL
+func (s URLSource) Load(ctx context.Context) (*KeySet, error) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return readJWKS(resp)
+}
+
+// FileSource lee el JWKS desde un archivo local (útil sin red para probar rotaciones)
+type FileSource struct {
+	Path string
+}
+
+// Load lee y parsea el archivo JWKS
+func (s FileSource) Load(ctx context.Context) (*KeySet, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS file: %w", err)
+	}
+	return ParseJWKS(data)
+}
+
+// KeyCacheConfig configuración de la caché de claves
+type KeyCacheConfig struct {
+	// Source origen del JWKS (URL o archivo)
+	Source JWKSSource
+	// RefreshInterval frecuencia del refresco en segundo plano
+	RefreshInterval time.Duration
+	// MinRefetchInterval tiempo mínimo entre refetches provocados por kid desconocidos
+	MinRefetchInterval time.Duration
+}
+
+// KeyCache mantiene las claves de firma por kid y las refresca ante rotaciones
+type KeyCache struct {
+	cfg KeyCacheConfig
+
+	mu          sync.RWMutex
+	keys        *KeySet
+	lastRefetch time.Time
+
+	// refetchMu serializa los refetches para que varias peticiones con el
+	// mismo kid desconocido provoquen una sola descarga
+	refetchMu sync.Mutex
+}
+
+// NewKeyCache crea la caché y realiza la carga inicial
+func NewKeyCache(ctx context.Context, cfg KeyCacheConfig) (*KeyCache, error) {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 10 * time.Minute
+	}
+	if cfg.MinRefetchInterval <= 0 {
+		cfg.MinRefetchInterval = 30 * time.Second
+	}
+
+	kc := &KeyCache{cfg: cfg}
+	if err := kc.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return kc, nil
+}
+
+// Refresh recarga las claves desde el origen
+func (kc *KeyCache) Refresh(ctx context.Context) error {
+	keys, err := kc.cfg.Source.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	kc.mu.Lock()
+	kc.keys = keys
+	kc.lastRefetch = time.Now()
+	kc.mu.Unlock()
+
+	return nil
+}
+
+// Start refresca las claves periódicamente hasta que ctx se cancele
+func (kc *KeyCache) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(kc.cfg.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Ante un fallo se conservan las claves anteriores
+				if err := kc.Refresh(ctx); err != nil {
+					log.Printf("Warning: JWKS refresh failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// LookupKey devuelve la clave del kid; si no existe, refetch con límite de frecuencia
+func (kc *KeyCache) LookupKey(kid string) (crypto.PublicKey, error) {
+	if key, err := kc.current().LookupKey(kid); err == nil {
+		return key, nil
+	}
+
+	kc.refetchMu.Lock()
+	defer kc.refetchMu.Unlock()
+
+	// Otra petición pudo haber refrescado mientras esperábamos
+	if key, err := kc.current().LookupKey(kid); err == nil {
+		return key, nil
+	}
+
+	kc.mu.RLock()
+	recent := time.Since(kc.lastRefetch) < kc.cfg.MinRefetchInterval
+	kc.mu.RUnlock()
+	if recent {
+		return nil, ErrUnknownKey
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := kc.Refresh(ctx); err != nil {
+		log.Printf("Warning: JWKS refetch for kid %q failed: %v", kid, err)
+		kc.mu.Lock()
+		kc.lastRefetch = time.Now()
+		kc.mu.Unlock()
+		return nil, ErrUnknownKey
+	}
+
+	return kc.current().LookupKey(kid)
+}
+
+// current devuelve el KeySet vigente
+func (kc *KeyCache) current() *KeySet {
+	kc.mu.RLock()
+	defer kc.mu.RUnlock()
+	return kc.keys
+}
@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goServices/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+// encryptedKeyPrefix marca las claves privadas guardadas cifradas
+const encryptedKeyPrefix = "enc:"
+
+// missReloadInterval espera mínima entre dos recargas por un kid desconocido
+const missReloadInterval = 10 * time.Second
+
+// KeyRingConfig configuración de la rotación de claves de firma
+type KeyRingConfig struct {
+	// RotationInterval cada cuánto se genera una clave nueva (30 días por defecto)
+	RotationInterval time.Duration
+	// Retention tiempo que una clave retirada sigue publicada; debe cubrir la vida
+	// de los tokens que firmó (48h por defecto)
+	Retention time.Duration
+	// Secret cifra las claves privadas guardadas en la base; vacío las guarda en claro
+	Secret []byte
+}
+
+// KeyRing claves de firma de los tokens propios: la activa firma y todas las
+// publicadas verifican. Implementa KeySource.
+type KeyRing struct {
+	db  *gorm.DB
+	cfg KeyRingConfig
+
+	mu         sync.RWMutex
+	active     *Signer
+	keys       map[string]*Signer
+	lastReload time.Time
+}
+
+// NewStaticKeyRing keyring de una sola clave fija, sin rotación (AUTH_SIGNING_KEY_FILE)
+func NewStaticKeyRing(signer *Signer) *KeyRing {
+	return &KeyRing{
+		active: signer,
+		keys:   map[string]*Signer{signer.Kid(): signer},
+	}
+}
+
+// NewKeyRing keyring con las claves guardadas en la base; crea la primera si no hay ninguna
+func NewKeyRing(db *gorm.DB, cfg KeyRingConfig) (*KeyRing, error) {
+	if cfg.RotationInterval <= 0 {
+		cfg.RotationInterval = 30 * 24 * time.Hour
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 48 * time.Hour
+	}
+
+	k := &KeyRing{db: db, cfg: cfg}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	if k.Signer() == nil {
+		if err := k.rotate(true); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Signer clave activa para firmar
+func (k *KeyRing) Signer() *Signer {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// LookupKey clave pública publicada con el kid dado. Un kid desconocido puede
+// venir de una rotación hecha por otra instancia: se recargan las claves, como
+// mucho una vez cada missReloadInterval.
+func (k *KeyRing) LookupKey(kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	signer, ok := k.keys[kid]
+	stale := time.Since(k.lastReload) > missReloadInterval
+	k.mu.RUnlock()
+
+	if !ok && stale && k.db != nil {
+		k.mu.Lock()
+		k.lastReload = time.Now()
+		k.mu.Unlock()
+		if err := k.Reload(); err != nil {
+			log.Printf("Warning: failed to reload signing keys: %v", err)
+		}
+		k.mu.RLock()
+		signer, ok = k.keys[kid]
+		k.mu.RUnlock()
+	}
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return signer.PublicKey(), nil
+}
+
+// JWKS documento JWKS con las claves publicadas, la activa primero
+func (k *KeyRing) JWKS() JWKSDocument {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	doc := JWKSDocument{Keys: []JWK{}}
+	if k.active != nil {
+		doc.Keys = append(doc.Keys, k.active.JWK())
+	}
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		if k.active == nil || kid != k.active.Kid() {
+			kids = append(kids, kid)
+		}
+	}
+	sort.Strings(kids)
+	for _, kid := range kids {
+		doc.Keys = append(doc.Keys, k.keys[kid].JWK())
+	}
+	return doc
+}
+
+// Reload relee las claves de la base; recoge las rotaciones hechas por otras instancias
+func (k *KeyRing) Reload() error {
+	if k.db == nil {
+		return nil
+	}
+
+	var rows []models.ClaveFirma
+	if err := k.db.
+		Where("retirada_at IS NULL OR retirada_at > ?", time.Now().Add(-k.cfg.Retention)).
+		Order("created_at DESC").
+		Find(&rows).Error; err != nil {
+		return err
+	}
+
+	var active *Signer
+	keys := make(map[string]*Signer, len(rows))
+	for _, row := range rows {
+		signer, err := k.decode(row.ClavePrivada)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.Kid, err)
+		}
+		keys[signer.Kid()] = signer
+		if active == nil && row.RetiradaAt == nil {
+			active = signer
+		}
+	}
+
+	k.mu.Lock()
+	k.active = active
+	k.keys = keys
+	k.lastReload = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// Rotate genera una clave nueva, la activa y retira las anteriores
+func (k *KeyRing) Rotate() error {
+	return k.rotate(false)
+}
+
+// rotate rota la clave; con onlyIfDue solo si no hay clave activa o la activa
+// superó RotationInterval. Un lock asesor evita que dos instancias roten a la vez
+// y la comprobación dentro del lock que ambas roten seguido.
+func (k *KeyRing) rotate(onlyIfDue bool) error {
+	if k.db == nil {
+		return errors.New("static key ring cannot rotate")
+	}
+
+	var signer *Signer
+	err := k.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('claves_firma'))").Error; err != nil {
+			return err
+		}
+
+		if onlyIfDue {
+			var current models.ClaveFirma
+			err := tx.Where("retirada_at IS NULL").Order("created_at DESC").First(&current).Error
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return err
+			}
+			if err == nil && time.Since(current.CreatedAt) < k.cfg.RotationInterval {
+				return nil
+			}
+		}
+
+		var err error
+		if signer, err = GenerateSigner(); err != nil {
+			return err
+		}
+		encoded, err := k.encode(signer)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.ClaveFirma{}).
+			Where("retirada_at IS NULL").
+			Update("retirada_at", &now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ClaveFirma{Kid: signer.Kid(), ClavePrivada: encoded}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if signer != nil {
+		log.Printf("Signing key rotated, new kid %s", signer.Kid())
+	}
+	return k.Reload()
+}
+
+// Start relee las claves cada interval y rota la activa al cumplir RotationInterval
+func (k *KeyRing) Start(ctx context.Context, interval time.Duration) {
+	if k.db == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := k.rotate(true); err != nil {
+					log.Printf("Warning: signing key rotation failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Cleanup borra las claves retiradas que ya no se publican
+func (k *KeyRing) Cleanup() error {
+	if k.db == nil {
+		return nil
+	}
+	return k.db.Where("retirada_at < ?", time.Now().Add(-k.cfg.Retention)).Delete(&models.ClaveFirma{}).Error
+}
+
+// encode serializa la clave privada en PEM PKCS#8 y la cifra si hay secreto
+func (k *KeyRing) encode(signer *Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(signer.key)
+	if err != nil {
+		return "", err
+	}
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if len(k.cfg.Secret) == 0 {
+		return string(encoded), nil
+	}
+
+	gcm, err := k.cipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, encoded, nil)
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decode descifra si hace falta y parsea la clave privada
+func (k *KeyRing) decode(stored string) (*Signer, error) {
+	data := []byte(stored)
+	if strings.HasPrefix(stored, encryptedKeyPrefix) {
+		if len(k.cfg.Secret) == 0 {
+			return nil, errors.New("key is encrypted but no secret is configured")
+		}
+		sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedKeyPrefix))
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := k.cipher()
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < gcm.NonceSize() {
+			return nil, errors.New("encrypted key too short")
+		}
+		data, err = gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+		if err != nil {
+			return nil, errors.New("cannot decrypt key, wrong secret")
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA key")
+	}
+	return NewSigner(key), nil
+}
+
+// cipher AES-256-GCM con la clave derivada del secreto
+func (k *KeyRing) cipher() (cipher.AEAD, error) {
+	sum := sha256.Sum256(k.cfg.Secret)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,386 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrLockoutUserNotFound el usuario a desbloquear no existe
+var ErrLockoutUserNotFound = errors.New("user not found")
+
+// LockedError la cuenta o la IP están bloqueadas temporalmente
+type LockedError struct {
+	// Scope "account" o "ip"
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return "too many failed attempts"
+}
+
+// AttemptState fallos recientes de una clave
+type AttemptState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil *time.Time
+}
+
+// AttemptStore guarda los fallos por cuenta y por IP
+type AttemptStore interface {
+	// Get estado de la clave; cero si no tiene fallos
+	Get(key string) (AttemptState, error)
+	// RecordFailure suma un fallo; la cuenta vuelve a 1 si el anterior fue antes de since
+	RecordFailure(key string, now, since time.Time) (AttemptState, error)
+	// Lock bloquea la clave hasta until
+	Lock(key string, until time.Time) error
+	// Reset borra los fallos y el bloqueo de la clave
+	Reset(key string) error
+	// Cleanup purga las claves sin fallos recientes ni bloqueo vigente
+	Cleanup() error
+}
+
+// LockoutPolicy umbrales de una clase de clave (cuenta o IP)
+type LockoutPolicy struct {
+	// FreeAttempts fallos permitidos sin espera
+	FreeAttempts int
+	// CaptchaAfter fallos a partir de los cuales se pide CAPTCHA
+	CaptchaAfter int
+	// BaseDelay primer bloqueo; se duplica con cada fallo siguiente
+	BaseDelay time.Duration
+	// MaxDelay bloqueo máximo
+	MaxDelay time.Duration
+}
+
+// LockoutConfig configuración de la protección contra fuerza bruta
+type LockoutConfig struct {
+	Account LockoutPolicy
+	IP      LockoutPolicy
+	// Window tras este tiempo sin fallos la cuenta vuelve a cero (1h por defecto)
+	Window time.Duration
+}
+
+// LockoutStatus señal para el cliente tras comprobar o registrar un intento
+type LockoutStatus struct {
+	CaptchaRequired bool
+}
+
+// LockoutService aplica espera exponencial y bloqueos temporales por cuenta y por IP
+type LockoutService struct {
+	db    *gorm.DB
+	store AttemptStore
+	cfg   LockoutConfig
+}
+
+// NewLockoutService crea el servicio; db solo se usa para desbloquear por usuario
+func NewLockoutService(db *gorm.DB, store AttemptStore, cfg LockoutConfig) *LockoutService {
+	cfg.Account = withPolicyDefaults(cfg.Account, 5, 3)
+	cfg.IP = withPolicyDefaults(cfg.IP, 20, 10)
+	if cfg.Window <= 0 {
+		cfg.Window = time.Hour
+	}
+	return &LockoutService{db: db, store: store, cfg: cfg}
+}
+
+// withPolicyDefaults completa los valores no configurados
+func withPolicyDefaults(p LockoutPolicy, free, captcha int) LockoutPolicy {
+	if p.FreeAttempts <= 0 {
+		p.FreeAttempts = free
+	}
+	if p.CaptchaAfter <= 0 {
+		p.CaptchaAfter = captcha
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 5 * time.Second
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 15 * time.Minute
+	}
+	return p
+}
+
+// AccountKey clave de cuenta a partir de un email, teléfono o user id
+func AccountKey(kind, identifier string) string {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+	if identifier == "" {
+		return ""
+	}
+	return kind + ":" + identifier
+}
+
+// ipKey clave de una IP
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check devuelve *LockedError si la cuenta o la IP están bloqueadas; account
+// puede ir vacío cuando el endpoint no identifica la cuenta
+func (s *LockoutService) Check(account, ip string) (LockoutStatus, error) {
+	var status LockoutStatus
+	now := time.Now()
+
+	for _, k := range s.keys(account, ip) {
+		state, err := s.store.Get(k.key)
+		if err != nil {
+			return status, err
+		}
+		if state.LockedUntil != nil && now.Before(*state.LockedUntil) {
+			return LockoutStatus{CaptchaRequired: true}, &LockedError{Scope: k.scope, RetryAfter: state.LockedUntil.Sub(now)}
+		}
+		if now.Sub(state.LastFailure) < s.cfg.Window && state.Failures >= k.policy.CaptchaAfter {
+			status.CaptchaRequired = true
+		}
+	}
+	return status, nil
+}
+
+// Fail registra un intento fallido y bloquea la cuenta o la IP si superan sus
+// intentos libres: BaseDelay, el doble en el siguiente fallo, hasta MaxDelay
+func (s *LockoutService) Fail(account, ip string) (LockoutStatus, error) {
+	var status LockoutStatus
+	now := time.Now()
+
+	for _, k := range s.keys(account, ip) {
+		state, err := s.store.RecordFailure(k.key, now, now.Add(-s.cfg.Window))
+		if err != nil {
+			return status, err
+		}
+		if state.Failures >= k.policy.CaptchaAfter {
+			status.CaptchaRequired = true
+		}
+		if extra := state.Failures - k.policy.FreeAttempts; extra > 0 {
+			if err := s.store.Lock(k.key, now.Add(backoff(k.policy, extra))); err != nil {
+				return status, err
+			}
+		}
+	}
+	return status, nil
+}
+
+// Succeed borra los fallos de la cuenta. Los de la IP se mantienen: un acierto
+// con una cuenta propia no debe limpiar los intentos contra otras.
+func (s *LockoutService) Succeed(account string) error {
+	if account == "" {
+		return nil
+	}
+	return s.store.Reset(account)
+}
+
+// UnlockUser borra fallos y bloqueos de todas las claves de cuenta del usuario
+// (email, teléfono y user id)
+func (s *LockoutService) UnlockUser(userID uuid.UUID) error {
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLockoutUserNotFound
+	}
+
+	keys := []string{AccountKey("user", userID.String())}
+	var cuenta models.CuentaLocal
+	if err := s.db.Select("email").First(&cuenta, "id_usuario = ?", userID).Error; err == nil {
+		keys = append(keys, AccountKey("email", cuenta.Email))
+	}
+	var perfil models.PerfilCliente
+	if err := s.db.Select("telefono").First(&perfil, "id_usuario = ?", userID).Error; err == nil && perfil.Telefono != "" {
+		keys = append(keys, AccountKey("phone", NormalizePhone(perfil.Telefono)))
+	}
+
+	for _, key := range keys {
+		if err := s.store.Reset(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cleanup purga el store
+func (s *LockoutService) Cleanup() error {
+	return s.store.Cleanup()
+}
+
+// lockoutKey clave a comprobar con su política
+type lockoutKey struct {
+	key    string
+	scope  string
+	policy LockoutPolicy
+}
+
+// keys claves de la cuenta (si se conoce) y de la IP
+func (s *LockoutService) keys(account, ip string) []lockoutKey {
+	keys := make([]lockoutKey, 0, 2)
+	if account != "" {
+		keys = append(keys, lockoutKey{key: account, scope: "account", policy: s.cfg.Account})
+	}
+	if ip != "" {
+		keys = append(keys, lockoutKey{key: ipKey(ip), scope: "ip", policy: s.cfg.IP})
+	}
+	return keys
+}
+
+// backoff espera tras el fallo número extra por encima de los libres
+func backoff(p LockoutPolicy, extra int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < extra && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// MemoryAttemptStore store en memoria; solo sirve con una única instancia
+type MemoryAttemptStore struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*AttemptState
+}
+
+// NewMemoryAttemptStore crea un store en memoria; window antigüedad a partir de
+// la cual Cleanup descarta fallos sin bloqueo vigente
+func NewMemoryAttemptStore(window time.Duration) *MemoryAttemptStore {
+	if window <= 0 {
+		window = time.Hour
+	}
+	return &MemoryAttemptStore{window: window, entries: make(map[string]*AttemptState)}
+}
+
+// Get estado de la clave
+func (s *MemoryAttemptStore) Get(key string) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := s.entries[key]; ok {
+		return *state, nil
+	}
+	return AttemptState{}, nil
+}
+
+// RecordFailure suma un fallo a la clave
+func (s *MemoryAttemptStore) RecordFailure(key string, now, since time.Time) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.entries[key]
+	if !ok {
+		state = &AttemptState{}
+		s.entries[key] = state
+	}
+	if state.LastFailure.Before(since) {
+		state.Failures = 0
+	}
+	state.Failures++
+	state.LastFailure = now
+	return *state, nil
+}
+
+// Lock bloquea la clave hasta until
+func (s *MemoryAttemptStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.entries[key]
+	if !ok {
+		state = &AttemptState{}
+		s.entries[key] = state
+	}
+	state.LockedUntil = &until
+	return nil
+}
+
+// Reset borra la clave
+func (s *MemoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// Cleanup purga claves sin fallos recientes ni bloqueo vigente
+func (s *MemoryAttemptStore) Cleanup() error {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, state := range s.entries {
+		locked := state.LockedUntil != nil && now.Before(*state.LockedUntil)
+		if !locked && now.Sub(state.LastFailure) > s.window {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
+
+// PostgresAttemptStore store compartido entre instancias sobre intentos_fallidos
+type PostgresAttemptStore struct {
+	db     *gorm.DB
+	window time.Duration
+}
+
+// NewPostgresAttemptStore crea el store persistente
+func NewPostgresAttemptStore(db *gorm.DB, window time.Duration) *PostgresAttemptStore {
+	if window <= 0 {
+		window = time.Hour
+	}
+	return &PostgresAttemptStore{db: db, window: window}
+}
+
+// Get estado de la clave
+func (s *PostgresAttemptStore) Get(key string) (AttemptState, error) {
+	var row models.IntentoFallido
+	if err := s.db.First(&row, "clave = ?", key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return AttemptState{}, nil
+		}
+		return AttemptState{}, err
+	}
+	return AttemptState{Failures: row.Fallos, LastFailure: row.UltimoFallo, LockedUntil: row.BloqueadaHasta}, nil
+}
+
+// RecordFailure suma un fallo en una sola sentencia, segura entre instancias
+func (s *PostgresAttemptStore) RecordFailure(key string, now, since time.Time) (AttemptState, error) {
+	var row models.IntentoFallido
+	err := s.db.Raw(`
+		INSERT INTO intentos_fallidos (clave, fallos, ultimo_fallo) VALUES (?, 1, ?)
+		ON CONFLICT (clave) DO UPDATE SET
+			fallos = CASE WHEN intentos_fallidos.ultimo_fallo < ? THEN 1 ELSE intentos_fallidos.fallos + 1 END,
+			ultimo_fallo = EXCLUDED.ultimo_fallo
+		RETURNING clave, fallos, ultimo_fallo, bloqueada_hasta`,
+		key, now, since,
+	).Scan(&row).Error
+	if err != nil {
+		return AttemptState{}, err
+	}
+	return AttemptState{Failures: row.Fallos, LastFailure: row.UltimoFallo, LockedUntil: row.BloqueadaHasta}, nil
+}
+
+// Lock bloquea la clave hasta until
+func (s *PostgresAttemptStore) Lock(key string, until time.Time) error {
+	return s.db.Model(&models.IntentoFallido{}).
+		Where("clave = ?", key).
+		Update("bloqueada_hasta", &until).Error
+}
+
+// Reset borra la clave
+func (s *PostgresAttemptStore) Reset(key string) error {
+	return s.db.Where("clave = ?", key).Delete(&models.IntentoFallido{}).Error
+}
+
+// Cleanup purga claves sin fallos recientes ni bloqueo vigente
+func (s *PostgresAttemptStore) Cleanup() error {
+	now := time.Now()
+	return s.db.
+		Where("ultimo_fallo < ? AND (bloqueada_hasta IS NULL OR bloqueada_hasta < ?)", now.Add(-s.window), now).
+		Delete(&models.IntentoFallido{}).Error
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// recoveryCodeCount códigos de recuperación generados al habilitar 2FA
+const recoveryCodeCount = 10
+
+// Errores de 2FA
+var (
+	ErrMFANotEnrolled    = errors.New("two-factor authentication not set up")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+)
+
+// MFAService gestiona el enrolamiento TOTP y los códigos de recuperación
+type MFAService struct {
+	db *gorm.DB
+	// issuer nombre que muestra la app autenticadora
+	issuer string
+}
+
+// NewMFAService crea el servicio de 2FA
+func NewMFAService(db *gorm.DB, issuer string) *MFAService {
+	return &MFAService{db: db, issuer: issuer}
+}
+
+// Setup genera un secreto TOTP pendiente de verificación y su QR
+func (s *MFAService) Setup(userID uuid.UUID, account string) (*models.TOTPSetupResponse, error) {
+	var current models.SegundoFactor
+	err := s.db.First(&current, "id_usuario = ?", userID).Error
+	if err == nil && current.Habilitado {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	// Un setup repetido antes de verificar reemplaza el secreto pendiente
+	factor := models.SegundoFactor{IDUsuario: userID, Secreto: secret}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id_usuario"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secreto", "habilitado", "ultimo_paso", "updated_at"}),
+	}).Create(&factor).Error; err != nil {
+		return nil, err
+	}
+
+	uri := TOTPURI(s.issuer, account, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRCodePNG:  base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// Enable verifica el primer código, habilita 2FA y devuelve los códigos de recuperación
+func (s *MFAService) Enable(userID uuid.UUID, code string) ([]string, error) {
+	var codes []string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var factor models.SegundoFactor
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&factor, "id_usuario = ?", userID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrMFANotEnrolled
+			}
+			return err
+		}
+		if factor.Habilitado {
+			return ErrMFAAlreadyEnabled
+		}
+
+		step, ok := ValidateTOTP(factor.Secreto, code, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		if err := tx.Model(&factor).Updates(map[string]interface{}{
+			"habilitado":  true,
+			"ultimo_paso": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable deshabilita 2FA tras validar un código TOTP o de recuperación
+func (s *MFAService) Disable(userID uuid.UUID, code string) error {
+	if _, err := s.Check(userID, code); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.SegundoFactor{}, "id_usuario = ?", userID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.CodigoRecuperacion{}, "id_usuario = ?", userID).Error
+	})
+}
+
+// RegenerateRecoveryCodes invalida los códigos anteriores y genera nuevos
+func (s *MFAService) RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error) {
+	if _, err := s.Check(userID, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// Enabled indica si el usuario tiene 2FA habilitado
+func (s *MFAService) Enabled(userID uuid.UUID) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.SegundoFactor{}).
+		Where("id_usuario = ? AND habilitado = ?", userID, true).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Check valida un código TOTP (sin reuso del mismo paso) o consume un código de
+// recuperación. Devuelve el método amr usado.
+func (s *MFAService) Check(userID uuid.UUID, code string) (string, error) {
+	var method string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var factor models.SegundoFactor
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&factor, "id_usuario = ? AND habilitado = ?", userID, true).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrMFANotEnrolled
+			}
+			return err
+		}
+
+		if step, ok := ValidateTOTP(factor.Secreto, code, time.Now()); ok {
+			if step <= factor.UltimoPaso {
+				return ErrInvalidMFACode
+			}
+			method = AMRTOTP
+			return tx.Model(&factor).Update("ultimo_paso", step).Error
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.CodigoRecuperacion{}).
+			Where("id_usuario = ? AND codigo_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+			Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+		method = AMRRecovery
+		return nil
+	})
+
+	return method, err
+}
+
+// replaceRecoveryCodes borra los códigos del usuario y guarda los hashes de unos nuevos
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	codes, err := GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Delete(&models.CodigoRecuperacion{}, "id_usuario = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]models.CodigoRecuperacion, len(codes))
+	for i, code := range codes {
+		rows[i] = models.CodigoRecuperacion{
+			IDCodigo:   uuid.New(),
+			IDUsuario:  userID,
+			CodigoHash: hashToken(normalizeRecoveryCode(code)),
+		}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,508 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Duraciones del flujo authorization code
+const (
+	authorizationRequestTTL = 10 * time.Minute
+	authorizationCodeTTL    = time.Minute
+	idTokenTTL              = time.Hour
+)
+
+// Errores del flujo authorization code que no se pueden devolver al cliente por
+// redirección: sin cliente o redirect_uri válidos no hay a dónde redirigir
+var (
+	ErrUnknownClient        = errors.New("unknown client_id")
+	ErrInvalidRedirectURI   = errors.New("redirect_uri not registered for client")
+	ErrAuthorizationExpired = errors.New("authorization request not found or expired")
+)
+
+// Códigos de error OAuth 2.0 (RFC 6749)
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+	// OAuthInvalidTarget audiencia desconocida en token exchange (RFC 8693)
+	OAuthInvalidTarget = "invalid_target"
+)
+
+// OAuthError error con código OAuth; se devuelve al cliente tal cual
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// oauthError atajo para construir un OAuthError
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OIDCClient cliente público registrado (p. ej. el frontend web)
+type OIDCClient struct {
+	ID           string
+	RedirectURIs []string
+}
+
+// OIDCConfig configuración del proveedor OIDC
+type OIDCConfig struct {
+	// Issuer URL pública del servicio; debe coincidir con el iss de los tokens
+	Issuer string
+	// LoginURL página del frontend que recibe ?request_id=, autentica al usuario y
+	// aprueba la solicitud en /api/auth/authorize/:id_solicitud
+	LoginURL string
+	// Clients clientes autorizados a usar el flujo authorization code
+	Clients []OIDCClient
+}
+
+// AuthorizeParams parámetros de /auth/authorize
+type AuthorizeParams struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// IDTokenClaims claims del id_token OIDC
+type IDTokenClaims struct {
+	Iss        string   `json:"iss"`
+	Sub        string   `json:"sub"`
+	Aud        Audience `json:"aud"`
+	Iat        int64    `json:"iat"`
+	Exp        int64    `json:"exp"`
+	AuthTime   int64    `json:"auth_time"`
+	Nonce      string   `json:"nonce,omitempty"`
+	Sid        string   `json:"sid,omitempty"`
+	Amr        AMR      `json:"amr,omitempty"`
+	Email      string   `json:"email,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	GivenName  string   `json:"given_name,omitempty"`
+	FamilyName string   `json:"family_name,omitempty"`
+	Picture    string   `json:"picture,omitempty"`
+	// EmailVerified solo se incluye con el scope email
+	EmailVerified *bool `json:"email_verified,omitempty"`
+}
+
+// OIDCProvider expone AuthService como proveedor OpenID Connect: discovery,
+// authorization code con PKCE, token endpoint e id_tokens firmados con el keyring
+type OIDCProvider struct {
+	db     *gorm.DB
+	tokens *TokenService
+	keys   *KeyRing
+	cfg    OIDCConfig
+}
+
+// NewOIDCProvider crea el proveedor OIDC
+func NewOIDCProvider(db *gorm.DB, tokens *TokenService, keys *KeyRing, cfg OIDCConfig) *OIDCProvider {
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &OIDCProvider{db: db, tokens: tokens, keys: keys, cfg: cfg}
+}
+
+// Discovery documento /.well-known/openid-configuration
+func (p *OIDCProvider) Discovery() models.OIDCDiscovery {
+	return models.OIDCDiscovery{
+		Issuer:                            p.cfg.Issuer,
+		AuthorizationEndpoint:             p.cfg.Issuer + "/auth/authorize",
+		TokenEndpoint:                     p.cfg.Issuer + "/auth/token",
+		UserinfoEndpoint:                  p.cfg.Issuer + "/auth/userinfo",
+		JWKSURI:                           p.cfg.Issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", GrantTypeClientCredentials, GrantTypeTokenExchange},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{AlgES256},
+		ScopesSupported:                   []string{"openid", "profile", "email"},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "iat", "exp", "auth_time", "nonce", "sid", "amr",
+			"email", "email_verified", "name", "given_name", "family_name", "picture",
+		},
+	}
+}
+
+// JWKS claves públicas publicadas en /.well-known/jwks.json
+func (p *OIDCProvider) JWKS() JWKSDocument {
+	return p.keys.JWKS()
+}
+
+// ValidateClient comprueba el cliente y su redirect_uri. Sus errores no se pueden
+// devolver por redirección.
+func (p *OIDCProvider) ValidateClient(clientID, redirectURI string) error {
+	client := p.client(clientID)
+	if client == nil {
+		return ErrUnknownClient
+	}
+	for _, uri := range client.RedirectURIs {
+		if uri == redirectURI {
+			return nil
+		}
+	}
+	return ErrInvalidRedirectURI
+}
+
+// Authorize valida la petición y la guarda pendiente de aprobación. Los errores
+// *OAuthError se devuelven al cliente redirigiendo a su redirect_uri.
+func (p *OIDCProvider) Authorize(params AuthorizeParams) (*models.SolicitudAutorizacion, error) {
+	if err := p.ValidateClient(params.ClientID, params.RedirectURI); err != nil {
+		return nil, err
+	}
+	if params.ResponseType != "code" {
+		return nil, oauthError(OAuthUnsupportedResponseType, "only response_type=code is supported")
+	}
+	if !hasScope(params.Scope, "openid") {
+		return nil, oauthError(OAuthInvalidScope, "scope must include openid")
+	}
+	// Clientes públicos: PKCE es obligatorio y solo con S256
+	if params.CodeChallengeMethod != "S256" || len(params.CodeChallenge) < 43 || len(params.CodeChallenge) > 128 {
+		return nil, oauthError(OAuthInvalidRequest, "code_challenge with code_challenge_method=S256 is required")
+	}
+
+	req := models.SolicitudAutorizacion{
+		IDSolicitud:   uuid.New(),
+		ClientID:      params.ClientID,
+		RedirectURI:   params.RedirectURI,
+		Scope:         params.Scope,
+		State:         params.State,
+		Nonce:         params.Nonce,
+		CodeChallenge: params.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationRequestTTL),
+	}
+	if err := p.db.Create(&req).Error; err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// LoginRedirect URL de la página de login para la solicitud pendiente
+func (p *OIDCProvider) LoginRedirect(req *models.SolicitudAutorizacion) string {
+	return appendQuery(p.cfg.LoginURL, url.Values{"request_id": {req.IDSolicitud.String()}})
+}
+
+// ErrorRedirect URL de vuelta al cliente con un error OAuth
+func (p *OIDCProvider) ErrorRedirect(redirectURI, state string, err *OAuthError) string {
+	q := url.Values{"error": {err.Code}, "error_description": {err.Description}}
+	if state != "" {
+		q.Set("state", state)
+	}
+	return appendQuery(redirectURI, q)
+}
+
+// PendingRequest solicitud pendiente y vigente
+func (p *OIDCProvider) PendingRequest(requestID uuid.UUID) (*models.SolicitudAutorizacion, error) {
+	var req models.SolicitudAutorizacion
+	if err := p.db.First(&req, "id_solicitud = ? AND expires_at > ?", requestID, time.Now()).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrAuthorizationExpired
+		}
+		return nil, err
+	}
+	return &req, nil
+}
+
+// Approve consume la solicitud para el usuario autenticado y devuelve la URL de
+// vuelta al cliente con el código de autorización
+func (p *OIDCProvider) Approve(requestID uuid.UUID, principal *Principal) (string, error) {
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	var amr []string
+	authTime := time.Now()
+	if principal.Claims != nil {
+		amr = principal.Claims.Amr
+		if principal.Claims.Iat > 0 {
+			authTime = time.Unix(principal.Claims.Iat, 0)
+		}
+	}
+	// auth_time es el login original, no la última renovación del access token
+	if sessionID, err := uuid.Parse(principal.SessionID); err == nil {
+		if session, err := p.tokens.FindSession(sessionID); err == nil {
+			authTime = session.CreatedAt
+		}
+	}
+
+	var req models.SolicitudAutorizacion
+	err = p.db.Transaction(func(tx *gorm.DB) error {
+		if err := p.consume(tx, requestID, &req); err != nil {
+			return err
+		}
+		return tx.Create(&models.CodigoAutorizacion{
+			CodigoHash:    hashToken(code),
+			IDUsuario:     principal.UserID,
+			ClientID:      req.ClientID,
+			RedirectURI:   req.RedirectURI,
+			Scope:         req.Scope,
+			Nonce:         req.Nonce,
+			CodeChallenge: req.CodeChallenge,
+			AMR:           strings.Join(amr, ","),
+			AuthTime:      authTime,
+			ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{"code": {code}}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, q), nil
+}
+
+// Deny consume la solicitud y devuelve la URL de vuelta con access_denied
+func (p *OIDCProvider) Deny(requestID uuid.UUID) (string, error) {
+	var req models.SolicitudAutorizacion
+	if err := p.db.Transaction(func(tx *gorm.DB) error {
+		return p.consume(tx, requestID, &req)
+	}); err != nil {
+		return "", err
+	}
+	return p.ErrorRedirect(req.RedirectURI, req.State, oauthError(OAuthAccessDenied, "the user denied the request")), nil
+}
+
+// Exchange atiende el token endpoint: canjea un código (authorization_code) o
+// rota un refresh token (refresh_token)
+func (p *OIDCProvider) Exchange(req models.OAuthTokenRequest, device models.DeviceInfo) (*models.TokenResponse, error) {
+	switch req.GrantType {
+	case "authorization_code":
+		return p.exchangeCode(req, device)
+	case "refresh_token":
+		if req.RefreshToken == "" {
+			return nil, oauthError(OAuthInvalidRequest, "refresh_token is required")
+		}
+		resp, err := p.tokens.Refresh(req.RefreshToken, device)
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) || errors.Is(err, ErrAccountDisabled) {
+			return nil, oauthError(OAuthInvalidGrant, err.Error())
+		}
+		return resp, err
+	case "":
+		return nil, oauthError(OAuthInvalidRequest, "grant_type is required")
+	}
+	return nil, oauthError(OAuthUnsupportedGrantType, "unsupported grant_type "+req.GrantType)
+}
+
+// UserInfo claims del usuario para /auth/userinfo
+func (p *OIDCProvider) UserInfo(principal *Principal) (*models.UserInfoResponse, error) {
+	var user models.User
+	if err := p.db.First(&user, "id = ?", principal.UserID).Error; err != nil {
+		return nil, err
+	}
+
+	info := &models.UserInfoResponse{
+		Sub:           user.ID.String(),
+		Email:         principal.Email,
+		EmailVerified: user.EmailVerificadoAt != nil,
+		Name:          strings.TrimSpace(user.Nombre + " " + user.Apellido),
+		GivenName:     user.Nombre,
+		FamilyName:    user.Apellido,
+		Picture:       user.FotoPerfil,
+	}
+
+	var cuenta models.CuentaLocal
+	if err := p.db.First(&cuenta, "id_usuario = ?", user.ID).Error; err == nil {
+		info.Email = cuenta.Email
+	}
+
+	var perfil models.PerfilCliente
+	if err := p.db.First(&perfil, "id_usuario = ?", user.ID).Error; err == nil {
+		info.PhoneNumber = perfil.Telefono
+		info.PhoneVerified = perfil.TelefonoVerificadoAt != nil
+	}
+
+	return info, nil
+}
+
+// Cleanup borra las solicitudes y códigos vencidos
+func (p *OIDCProvider) Cleanup() error {
+	now := time.Now()
+	if err := p.db.Where("expires_at < ?", now).Delete(&models.SolicitudAutorizacion{}).Error; err != nil {
+		return err
+	}
+	return p.db.Where("expires_at < ?", now).Delete(&models.CodigoAutorizacion{}).Error
+}
+
+// exchangeCode canjea el código validando cliente, redirect_uri y PKCE. Reusar un
+// código ya canjeado revoca la sesión que abrió (RFC 6749 §4.1.2).
+func (p *OIDCProvider) exchangeCode(req models.OAuthTokenRequest, device models.DeviceInfo) (*models.TokenResponse, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, oauthError(OAuthInvalidRequest, "code and code_verifier are required")
+	}
+	if p.client(req.ClientID) == nil {
+		return nil, oauthError(OAuthInvalidClient, "unknown client_id")
+	}
+
+	var code models.CodigoAutorizacion
+	var reused *uuid.UUID
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&code, "codigo_hash = ?", hashToken(req.Code)).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return oauthError(OAuthInvalidGrant, "invalid authorization code")
+			}
+			return err
+		}
+		if code.UsedAt != nil {
+			reused = code.IDSesion
+			return oauthError(OAuthInvalidGrant, "authorization code already used")
+		}
+		now := time.Now()
+		if now.After(code.ExpiresAt) {
+			return oauthError(OAuthInvalidGrant, "authorization code expired")
+		}
+		if code.ClientID != req.ClientID || code.RedirectURI != req.RedirectURI {
+			return oauthError(OAuthInvalidGrant, "client_id or redirect_uri mismatch")
+		}
+		if !verifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+			return oauthError(OAuthInvalidGrant, "invalid code_verifier")
+		}
+		return tx.Model(&code).Update("used_at", &now).Error
+	})
+	if err != nil {
+		if reused != nil {
+			if revokeErr := p.tokens.RevokeSession(*reused, models.RevocadaReuso); revokeErr != nil {
+				return nil, revokeErr
+			}
+		}
+		return nil, err
+	}
+
+	var user models.User
+	if err := p.db.First(&user, "id = ?", code.IDUsuario).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, oauthError(OAuthInvalidGrant, "user no longer exists")
+		}
+		return nil, err
+	}
+	var cuenta models.CuentaLocal
+	p.db.First(&cuenta, "id_usuario = ?", user.ID)
+
+	var amr []string
+	if code.AMR != "" {
+		amr = strings.Split(code.AMR, ",")
+	}
+	resp, err := p.tokens.IssuePair(&user, cuenta.Email, device, amr)
+	if errors.Is(err, ErrAccountDisabled) {
+		return nil, oauthError(OAuthInvalidGrant, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, _ := uuid.Parse(resp.SessionID)
+	if err := p.db.Model(&code).Update("id_sesion", sessionID).Error; err != nil {
+		return nil, err
+	}
+
+	idToken, err := p.idToken(&user, cuenta.Email, &code, resp.SessionID, amr)
+	if err != nil {
+		return nil, err
+	}
+	resp.IDToken = idToken
+	resp.Scope = code.Scope
+	return resp, nil
+}
+
+// idToken firma el id_token para el cliente del código
+func (p *OIDCProvider) idToken(user *models.User, email string, code *models.CodigoAutorizacion, sessionID string, amr []string) (string, error) {
+	now := time.Now()
+	claims := IDTokenClaims{
+		Iss:      p.cfg.Issuer,
+		Sub:      user.ID.String(),
+		Aud:      Audience{code.ClientID},
+		Iat:      now.Unix(),
+		Exp:      now.Add(idTokenTTL).Unix(),
+		AuthTime: code.AuthTime.Unix(),
+		Nonce:    code.Nonce,
+		Sid:      sessionID,
+		Amr:      AMR(amr),
+	}
+	if hasScope(code.Scope, "email") && email != "" {
+		verified := user.EmailVerificadoAt != nil
+		claims.Email = email
+		claims.EmailVerified = &verified
+	}
+	if hasScope(code.Scope, "profile") {
+		claims.Name = strings.TrimSpace(user.Nombre + " " + user.Apellido)
+		claims.GivenName = user.Nombre
+		claims.FamilyName = user.Apellido
+		claims.Picture = user.FotoPerfil
+	}
+	return p.keys.Signer().Sign(claims)
+}
+
+// consume bloquea y borra la solicitud pendiente; cada solicitud se aprueba una vez
+func (p *OIDCProvider) consume(tx *gorm.DB, requestID uuid.UUID, req *models.SolicitudAutorizacion) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(req, "id_solicitud = ? AND expires_at > ?", requestID, time.Now()).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrAuthorizationExpired
+		}
+		return err
+	}
+	return tx.Delete(req).Error
+}
+
+// client busca un cliente registrado por su ID
+func (p *OIDCProvider) client(clientID string) *OIDCClient {
+	for i := range p.cfg.Clients {
+		if p.cfg.Clients[i].ID == clientID {
+			return &p.cfg.Clients[i]
+		}
+	}
+	return nil
+}
+
+// verifyPKCE compara BASE64URL(SHA256(verifier)) con el challenge (RFC 7636)
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return hmac.Equal([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge))
+}
+
+// hasScope indica si la lista de scopes separada por espacios incluye scope
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// appendQuery agrega parámetros a una URL que puede tener query propia
+func appendQuery(rawURL string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + params.Encode()
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+	"goServices/pkg/notify"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errores del login sin contraseña
+var (
+	ErrInvalidOTP         = errors.New("invalid or expired code")
+	ErrUnsupportedChannel = errors.New("unsupported delivery channel")
+)
+
+// OTPConfig configuración del login sin contraseña
+type OTPConfig struct {
+	Sender notify.Sender
+	// MagicLinkURL página del frontend que recibe email y token y llama a /auth/otp/verify
+	MagicLinkURL string
+	// EmailTTL vida del enlace mágico (15m por defecto)
+	EmailTTL time.Duration
+	// SMSTTL vida del código SMS (5m por defecto)
+	SMSTTL time.Duration
+	// MaxAttempts intentos fallidos antes de invalidar el código (5 por defecto)
+	MaxAttempts int
+	// ResendInterval espera mínima entre dos envíos al mismo destino (60s por defecto)
+	ResendInterval time.Duration
+}
+
+// OTPService emite y valida enlaces mágicos por email y códigos de 6 dígitos por SMS
+type OTPService struct {
+	db  *gorm.DB
+	cfg OTPConfig
+}
+
+// NewOTPService crea el servicio de login sin contraseña
+func NewOTPService(db *gorm.DB, cfg OTPConfig) *OTPService {
+	if cfg.EmailTTL == 0 {
+		cfg.EmailTTL = 15 * time.Minute
+	}
+	if cfg.SMSTTL == 0 {
+		cfg.SMSTTL = 5 * time.Minute
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.ResendInterval == 0 {
+		cfg.ResendInterval = time.Minute
+	}
+	return &OTPService{db: db, cfg: cfg}
+}
+
+// Request envía un enlace mágico o un código al destino. No revela si existe una
+// cuenta: sin usuario asociado, o dentro del intervalo de reenvío, no envía nada
+// y no devuelve error.
+func (s *OTPService) Request(ctx context.Context, canal, destino string) error {
+	userID, err := s.resolveUser(canal, destino)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	var recent int64
+	if err := s.db.Model(&models.CodigoOTP{}).
+		Where("canal = ? AND destino = ? AND created_at > ?", canal, destino, time.Now().Add(-s.cfg.ResendInterval)).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	var code string
+	ttl := s.cfg.SMSTTL
+	if canal == notify.ChannelEmail {
+		code, err = randomToken()
+		ttl = s.cfg.EmailTTL
+	} else {
+		code, err = randomDigits(totpDigits)
+	}
+	if err != nil {
+		return err
+	}
+
+	otp := models.CodigoOTP{
+		IDCodigo:  uuid.New(),
+		IDUsuario: userID,
+		Canal:     canal,
+		Destino:   destino,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	otp.CodigoHash = hashOTP(otp.IDCodigo, code)
+
+	// Un código nuevo invalida los anteriores del mismo destino
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("canal = ? AND destino = ? AND used_at IS NULL", canal, destino).
+			Delete(&models.CodigoOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&otp).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.cfg.Sender.Send(ctx, s.message(canal, destino, code, ttl))
+}
+
+// Verify canjea el código del destino y devuelve el usuario. Cada fallo suma un
+// intento; al llegar a MaxAttempts el código deja de servir.
+func (s *OTPService) Verify(canal, destino, code string) (*models.User, error) {
+	var userID uuid.UUID
+	valid := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var otp models.CodigoOTP
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("canal = ? AND destino = ? AND used_at IS NULL AND expires_at > ?", canal, destino, time.Now()).
+			Order("created_at DESC").
+			First(&otp).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+		if otp.Intentos >= s.cfg.MaxAttempts {
+			return nil
+		}
+
+		if !hmac.Equal([]byte(hashOTP(otp.IDCodigo, strings.TrimSpace(code))), []byte(otp.CodigoHash)) {
+			return tx.Model(&otp).Update("intentos", gorm.Expr("intentos + 1")).Error
+		}
+
+		now := time.Now()
+		if err := tx.Model(&otp).Update("used_at", &now).Error; err != nil {
+			return err
+		}
+		userID = otp.IDUsuario
+		valid = true
+
+		// Recibir el código prueba el control del email o del teléfono
+		if canal == notify.ChannelEmail {
+			return tx.Model(&models.User{}).
+				Where("id = ? AND email_verificado_at IS NULL", otp.IDUsuario).
+				Update("email_verificado_at", &now).Error
+		}
+		_, err := markPhoneVerified(tx, otp.IDUsuario, destino, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrInvalidOTP
+	}
+
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidOTP
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Cleanup borra los códigos vencidos
+func (s *OTPService) Cleanup() error {
+	return s.db.Where("expires_at < ?", time.Now()).Delete(&models.CodigoOTP{}).Error
+}
+
+// resolveUser busca el usuario del email (cuenta local) o del teléfono verificado
+// del perfil de cliente. Un teléfono compartido por varios perfiles no permite el login.
+func (s *OTPService) resolveUser(canal, destino string) (uuid.UUID, error) {
+	switch canal {
+	case notify.ChannelEmail:
+		var cuenta models.CuentaLocal
+		if err := s.db.First(&cuenta, "email = ?", destino).Error; err != nil {
+			return uuid.Nil, err
+		}
+		return cuenta.IDUsuario, nil
+	case notify.ChannelSMS:
+		var perfiles []models.PerfilCliente
+		// Un teléfono sin verificar lo pudo escribir cualquiera en su perfil
+		err := s.db.Where("telefono = ? AND telefono_verificado_at IS NOT NULL", destino).
+			Limit(2).
+			Find(&perfiles).Error
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if len(perfiles) != 1 {
+			if len(perfiles) > 1 {
+				log.Printf("Warning: phone %s belongs to several profiles, SMS login disabled for it", destino)
+			}
+			return uuid.Nil, gorm.ErrRecordNotFound
+		}
+		return perfiles[0].IDUsuario, nil
+	}
+	return uuid.Nil, ErrUnsupportedChannel
+}
+
+// message arma el email con el enlace mágico o el SMS con el código
+func (s *OTPService) message(canal, destino, code string, ttl time.Duration) notify.Message {
+	minutes := int(ttl.Minutes())
+	if canal == notify.ChannelEmail {
+		link := s.cfg.MagicLinkURL + "?" + url.Values{"email": {destino}, "token": {code}}.Encode()
+		return notify.Message{
+			Channel: notify.ChannelEmail,
+			To:      destino,
+			Subject: "Tu enlace de acceso",
+			Body:    fmt.Sprintf("Ingresa con este enlace (vence en %d minutos):\n%s", minutes, link),
+		}
+	}
+	return notify.Message{
+		Channel: notify.ChannelSMS,
+		To:      destino,
+		Body:    fmt.Sprintf("Tu código de acceso es %s. Vence en %d minutos.", code, minutes),
+	}
+}
+
+// NormalizePhone quita espacios, guiones, puntos y paréntesis de un teléfono
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+}
+
+// randomDigits genera un código numérico uniforme de n dígitos
+func randomDigits(n int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	v, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", n, v), nil
+}
+
+// hashOTP hash del código salado con su id, para que dos filas con el mismo
+// código de 6 dígitos no compartan hash
+func hashOTP(id uuid.UUID, code string) string {
+	return hashToken(id.String() + ":" + code)
+}
@@ -0,0 +1,392 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// passkeyCeremonyTTL vida de un challenge de registro o login con passkey
+const passkeyCeremonyTTL = 5 * time.Minute
+
+// Errores de passkeys
+var (
+	ErrInvalidCeremony  = errors.New("invalid or expired passkey ceremony")
+	ErrInvalidPasskey   = errors.New("invalid passkey response")
+	ErrPasskeyNotFound  = errors.New("passkey not found")
+	ErrPasskeyCloned    = errors.New("passkey sign count did not advance, possible cloned authenticator")
+	ErrPasskeyDuplicate = errors.New("passkey already registered")
+)
+
+// PasskeyConfig datos del relying party WebAuthn
+type PasskeyConfig struct {
+	// RPID dominio del relying party (ej. example.com)
+	RPID          string
+	RPDisplayName string
+	// RPOrigins orígenes completos desde los que se aceptan ceremonias
+	RPOrigins []string
+}
+
+// PasskeyService gestiona el registro de passkeys y el login con ellas
+type PasskeyService struct {
+	db       *gorm.DB
+	webauthn *webauthn.WebAuthn
+}
+
+// NewPasskeyService crea el servicio de passkeys
+func NewPasskeyService(db *gorm.DB, cfg PasskeyConfig) (*PasskeyService, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: passkeyCeremonyTTL, TimeoutUVD: passkeyCeremonyTTL}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyService{db: db, webauthn: wa}, nil
+}
+
+// BeginRegistration inicia el registro de una passkey para el usuario
+func (s *PasskeyService) BeginRegistration(userID uuid.UUID, account string) (*models.PasskeyBeginResponse, error) {
+	user, err := s.loadUser(userID, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// Passkey descubrible (login sin usuario) y sin repetir autenticadores ya registrados
+	exclusions := make([]protocol.CredentialDescriptor, len(user.credentials))
+	for i, cred := range user.credentials {
+		exclusions[i] = cred.Descriptor()
+	}
+	creation, session, err := s.webauthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.saveCeremony(models.CeremoniaRegistro, &userID, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PasskeyBeginResponse{CeremonyID: id.String(), Options: creation}, nil
+}
+
+// FinishRegistration valida la respuesta de navigator.credentials.create y guarda la passkey
+func (s *PasskeyService) FinishRegistration(userID uuid.UUID, account string, ceremonyID uuid.UUID, body []byte, nombre string) (*models.Credential, error) {
+	session, err := s.consumeCeremony(ceremonyID, models.CeremoniaRegistro, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(body)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+
+	user, err := s.loadUser(userID, account)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := s.webauthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+
+	var exists int64
+	if err := s.db.Model(&models.Credential{}).Where("credential_id = ?", cred.ID).Count(&exists).Error; err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return nil, ErrPasskeyDuplicate
+	}
+
+	credential := newCredential(userID, cred, nombre)
+	if err := s.db.Create(&credential).Error; err != nil {
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+// BeginLogin inicia un login con passkey descubrible; el usuario se identifica
+// por el user handle de la respuesta
+func (s *PasskeyService) BeginLogin() (*models.PasskeyBeginResponse, error) {
+	assertion, session, err := s.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationPreferred),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.saveCeremony(models.CeremoniaLogin, nil, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PasskeyBeginResponse{CeremonyID: id.String(), Options: assertion}, nil
+}
+
+// FinishLogin valida la respuesta de navigator.credentials.get, actualiza el
+// contador de firmas y devuelve el usuario y los métodos amr del login
+func (s *PasskeyService) FinishLogin(ceremonyID uuid.UUID, body []byte) (*models.User, []string, error) {
+	session, err := s.consumeCeremony(ceremonyID, models.CeremoniaLogin, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(body)
+	if err != nil {
+		return nil, nil, ErrInvalidPasskey
+	}
+
+	var owner *passkeyUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		owner, err = s.loadUser(userID, "")
+		return owner, err
+	}
+
+	_, cred, err := s.webauthn.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		return nil, nil, ErrInvalidPasskey
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"sign_count":   int64(cred.Authenticator.SignCount),
+		"backup_state": cred.Flags.BackupState,
+		"last_used_at": &now,
+	}
+	if cred.Authenticator.CloneWarning {
+		updates["clone_warning"] = true
+	}
+	if err := s.db.Model(&models.Credential{}).
+		Where("credential_id = ?", cred.ID).
+		Updates(updates).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// Un contador que no avanza indica una posible copia de la clave privada
+	if cred.Authenticator.CloneWarning {
+		return nil, nil, ErrPasskeyCloned
+	}
+
+	// Una passkey con verificación de usuario (PIN o biometría) combina posesión
+	// e inherencia/conocimiento, por lo que cuenta como multifactor (aal2)
+	amr := []string{AMRHardwareKey}
+	if parsed.Response.AuthenticatorData.Flags.HasUserVerified() {
+		amr = append(amr, AMRUserVerified)
+	}
+
+	return &owner.user, amr, nil
+}
+
+// List devuelve las passkeys del usuario
+func (s *PasskeyService) List(userID uuid.UUID) ([]models.Credential, error) {
+	var credentials []models.Credential
+	err := s.db.Where("id_usuario = ?", userID).Order("created_at").Find(&credentials).Error
+	return credentials, err
+}
+
+// Rename cambia el nombre de una passkey del usuario
+func (s *PasskeyService) Rename(userID, credentialID uuid.UUID, nombre string) (*models.Credential, error) {
+	var credential models.Credential
+	if err := s.db.First(&credential, "id_credencial = ? AND id_usuario = ?", credentialID, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrPasskeyNotFound
+		}
+		return nil, err
+	}
+
+	if err := s.db.Model(&credential).Update("nombre", nombre).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// Delete elimina una passkey del usuario
+func (s *PasskeyService) Delete(userID, credentialID uuid.UUID) error {
+	result := s.db.Where("id_credencial = ? AND id_usuario = ?", credentialID, userID).Delete(&models.Credential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// saveCeremony guarda el estado de la ceremonia y purga las vencidas
+func (s *PasskeyService) saveCeremony(tipo string, userID *uuid.UUID, session *webauthn.SessionData) (uuid.UUID, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	s.db.Where("expires_at < ?", time.Now()).Delete(&models.CeremoniaWebAuthn{})
+
+	ceremony := models.CeremoniaWebAuthn{
+		IDCeremonia: uuid.New(),
+		IDUsuario:   userID,
+		Tipo:        tipo,
+		Datos:       string(data),
+		ExpiresAt:   time.Now().Add(passkeyCeremonyTTL),
+	}
+	if err := s.db.Create(&ceremony).Error; err != nil {
+		return uuid.Nil, err
+	}
+	return ceremony.IDCeremonia, nil
+}
+
+// consumeCeremony borra la ceremonia y devuelve su estado; solo la primera
+// petición que la borra puede completarla
+func (s *PasskeyService) consumeCeremony(id uuid.UUID, tipo string, userID *uuid.UUID) (*webauthn.SessionData, error) {
+	var ceremony models.CeremoniaWebAuthn
+	if err := s.db.First(&ceremony, "id_ceremonia = ? AND tipo = ?", id, tipo).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidCeremony
+		}
+		return nil, err
+	}
+
+	result := s.db.Where("id_ceremonia = ?", id).Delete(&models.CeremoniaWebAuthn{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(ceremony.ExpiresAt) {
+		return nil, ErrInvalidCeremony
+	}
+	if userID != nil && (ceremony.IDUsuario == nil || *ceremony.IDUsuario != *userID) {
+		return nil, ErrInvalidCeremony
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(ceremony.Datos), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// loadUser carga el usuario y sus passkeys en el formato de la librería
+func (s *PasskeyService) loadUser(userID uuid.UUID, account string) (*passkeyUser, error) {
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	var stored []models.Credential
+	if err := s.db.Where("id_usuario = ?", userID).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, len(stored))
+	for i, c := range stored {
+		credentials[i] = webauthnCredential(c)
+	}
+
+	if account == "" {
+		account = user.ID.String()
+	}
+	return &passkeyUser{user: user, account: account, credentials: credentials}, nil
+}
+
+// newCredential convierte la credencial validada por la librería en la passkey que se guarda
+func newCredential(userID uuid.UUID, cred *webauthn.Credential, nombre string) models.Credential {
+	transports := make([]string, len(cred.Transport))
+	for i, t := range cred.Transport {
+		transports[i] = string(t)
+	}
+	if nombre == "" {
+		nombre = "Passkey"
+	}
+
+	return models.Credential{
+		IDCredencial:    uuid.New(),
+		IDUsuario:       userID,
+		CredentialID:    cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		Transports:      strings.Join(transports, ","),
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		SignCount:       int64(cred.Authenticator.SignCount),
+		Nombre:          nombre,
+	}
+}
+
+// webauthnCredential convierte una passkey guardada al formato de la librería
+func webauthnCredential(c models.Credential) webauthn.Credential {
+	var transports []protocol.AuthenticatorTransport
+	for _, t := range strings.Split(c.Transports, ",") {
+		if t != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+	return webauthn.Credential{
+		ID:              c.CredentialID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: c.BackupEligible,
+			BackupState:    c.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       c.AAGUID,
+			SignCount:    uint32(c.SignCount),
+			CloneWarning: c.CloneWarning,
+		},
+	}
+}
+
+// passkeyUser adapta models.User a la interfaz webauthn.User
+type passkeyUser struct {
+	user        models.User
+	account     string
+	credentials []webauthn.Credential
+}
+
+// WebAuthnID user handle: los 16 bytes del UUID del usuario
+func (u *passkeyUser) WebAuthnID() []byte {
+	id := u.user.ID
+	return id[:]
+}
+
+// WebAuthnName nombre de cuenta que muestra el autenticador
+func (u *passkeyUser) WebAuthnName() string {
+	return u.account
+}
+
+// WebAuthnDisplayName nombre para mostrar del usuario
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if name := strings.TrimSpace(u.user.Nombre + " " + u.user.Apellido); name != "" {
+		return name
+	}
+	return u.account
+}
+
+// WebAuthnCredentials passkeys registradas del usuario
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
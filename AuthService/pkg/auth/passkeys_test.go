@@ -0,0 +1,408 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"goServices/pkg/models"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// Flags de authenticator data (WebAuthn §6.1)
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackupState    = 0x10
+	flagAttestedData   = 0x40
+)
+
+// softAuthenticator autenticador de plataforma en memoria con una única
+// passkey ES256 y atestación "none"
+type softAuthenticator struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	signCount  uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, key: key, id: id}
+}
+
+// create responde a navigator.credentials.create
+func (a *softAuthenticator) create(options *protocol.CredentialCreation) []byte {
+	a.t.Helper()
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+	coseKey := a.cbor(map[int]interface{}{1: 2, 3: -7, -1: 1, -2: x, -3: y})
+
+	attested := make([]byte, 16, 16+2+len(a.id)+len(coseKey)) // AAGUID en ceros
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, coseKey...)
+
+	authData := a.authData(flagUserPresent|flagUserVerified|flagBackupEligible|flagBackupState|flagAttestedData, attested)
+	attestation := a.cbor(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+
+	return a.marshal(map[string]interface{}{
+		"id":    encode(a.id),
+		"rawId": encode(a.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(a.clientData("webauthn.create", options.Response.Challenge)),
+			"attestationObject": encode(attestation),
+			"transports":        []string{"internal", "hybrid"},
+		},
+	})
+}
+
+// get responde a navigator.credentials.get con el contador actual
+func (a *softAuthenticator) get(options *protocol.CredentialAssertion) []byte {
+	a.t.Helper()
+	authData := a.authData(flagUserPresent|flagUserVerified|flagBackupEligible|flagBackupState, nil)
+	clientData := a.clientData("webauthn.get", options.Response.Challenge)
+
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.marshal(map[string]interface{}{
+		"id":    encode(a.id),
+		"rawId": encode(a.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(a.userHandle),
+		},
+	})
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(tipo string, challenge protocol.URLEncodedBase64) []byte {
+	return a.marshal(map[string]string{
+		"type":      tipo,
+		"challenge": encode(challenge),
+		"origin":    testOrigin,
+	})
+}
+
+func (a *softAuthenticator) cbor(v interface{}) []byte {
+	a.t.Helper()
+	data, err := webauthncbor.Marshal(v)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) marshal(v interface{}) []byte {
+	a.t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// persistSession simula el paso de la ceremonia por la base de datos
+func persistSession(t *testing.T, session *webauthn.SessionData) webauthn.SessionData {
+	t.Helper()
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored webauthn.SessionData
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	return restored
+}
+
+func TestPasskeyRoundTrip(t *testing.T) {
+	s, err := NewPasskeyService(nil, PasskeyConfig{
+		RPID:          testRPID,
+		RPDisplayName: "Test",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+	user := &passkeyUser{user: models.User{ID: userID, Nombre: "Ana"}, account: "ana@example.com"}
+	authenticator := newSoftAuthenticator(t)
+
+	// Registro
+	creation, session, err := s.webauthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(authenticator.create(creation))
+	if err != nil {
+		t.Fatalf("parse creation: %v", err)
+	}
+	cred, err := s.webauthn.CreateCredential(user, persistSession(t, session), parsed)
+	if err != nil {
+		t.Fatalf("create credential: %v", err)
+	}
+
+	stored := newCredential(userID, cred, "")
+	if stored.Nombre != "Passkey" || stored.Transports != "internal,hybrid" || !stored.BackupEligible {
+		t.Fatalf("unexpected stored credential: %+v", stored)
+	}
+
+	// Login descubrible con la passkey tal como sale de la base de datos
+	login := func() (*webauthn.Credential, *protocol.ParsedCredentialAssertionData, error) {
+		t.Helper()
+		assertion, session, err := s.webauthn.BeginDiscoverableLogin(
+			webauthn.WithUserVerification(protocol.VerificationPreferred),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := protocol.ParseCredentialRequestResponseBytes(authenticator.get(assertion))
+		if err != nil {
+			t.Fatalf("parse assertion: %v", err)
+		}
+		handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+			id, err := uuid.FromBytes(userHandle)
+			if err != nil || id != userID {
+				t.Fatalf("user handle %x does not match the registered user", userHandle)
+			}
+			return &passkeyUser{user: user.user, credentials: []webauthn.Credential{webauthnCredential(stored)}}, nil
+		}
+		_, cred, err := s.webauthn.ValidatePasskeyLogin(handler, persistSession(t, session), parsed)
+		return cred, parsed, err
+	}
+
+	authenticator.signCount = 1
+	cred, assertion, err := login()
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if cred.Authenticator.CloneWarning {
+		t.Fatal("an advancing sign count must not raise a clone warning")
+	}
+	if !assertion.Response.AuthenticatorData.Flags.HasUserVerified() {
+		t.Fatal("user verification flag lost")
+	}
+	stored.SignCount = int64(cred.Authenticator.SignCount)
+
+	// Un contador que no avanza delata una copia de la clave
+	cred, _, err = login()
+	if err != nil {
+		t.Fatalf("replayed login: %v", err)
+	}
+	if !cred.Authenticator.CloneWarning {
+		t.Fatal("a stalled sign count must raise a clone warning")
+	}
+}
+
+func TestPasskeyRejectsForeignOrigin(t *testing.T) {
+	s, err := NewPasskeyService(nil, PasskeyConfig{
+		RPID:          testRPID,
+		RPDisplayName: "Test",
+		RPOrigins:     []string{"https://other.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &passkeyUser{user: models.User{ID: uuid.New()}, account: "ana@example.com"}
+	creation, session, err := s.webauthn.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(newSoftAuthenticator(t).create(creation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.webauthn.CreateCredential(user, persistSession(t, session), parsed); err == nil {
+		t.Fatal("registration from an origin outside RPOrigins must fail")
+	}
+}
+
+// testDB abre la base de TEST_DATABASE_URL y migra los modelos dentro de una
+// transacción que se revierte al terminar; sin la variable el test se omite
+func testDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	if err := tx.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestPasskeyServiceRoundTrip(t *testing.T) {
+	db := testDB(t, &models.User{}, &models.Credential{}, &models.CeremoniaWebAuthn{})
+	s, err := NewPasskeyService(db, PasskeyConfig{
+		RPID:          testRPID,
+		RPDisplayName: "Test",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := models.User{ID: uuid.New(), Nombre: "Ana"}
+	other := models.User{ID: uuid.New(), Nombre: "Luis"}
+	if err := db.Create(&[]models.User{owner, other}).Error; err != nil {
+		t.Fatal(err)
+	}
+	authenticator := newSoftAuthenticator(t)
+
+	// Registro: la ceremonia es del usuario que la inició y se usa una sola vez
+	begin, err := s.BeginRegistration(owner.ID, "ana@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ceremonyID := uuid.MustParse(begin.CeremonyID)
+	body := authenticator.create(begin.Options.(*protocol.CredentialCreation))
+
+	if _, err := s.FinishRegistration(other.ID, "", ceremonyID, body, ""); !errors.Is(err, ErrInvalidCeremony) {
+		t.Fatalf("finishing another user's ceremony: got %v, want ErrInvalidCeremony", err)
+	}
+	begin, err = s.BeginRegistration(owner.ID, "ana@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ceremonyID = uuid.MustParse(begin.CeremonyID)
+	body = authenticator.create(begin.Options.(*protocol.CredentialCreation))
+	credential, err := s.FinishRegistration(owner.ID, "", ceremonyID, body, "")
+	if err != nil {
+		t.Fatalf("registration: %v", err)
+	}
+	if credential.IDUsuario != owner.ID || credential.Nombre != "Passkey" {
+		t.Fatalf("unexpected credential: %+v", credential)
+	}
+	if _, err := s.FinishRegistration(owner.ID, "", ceremonyID, body, ""); !errors.Is(err, ErrInvalidCeremony) {
+		t.Fatalf("reused ceremony: got %v, want ErrInvalidCeremony", err)
+	}
+
+	login := func() (*models.User, []string, error) {
+		t.Helper()
+		begin, err := s.BeginLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := authenticator.get(begin.Options.(*protocol.CredentialAssertion))
+		return s.FinishLogin(uuid.MustParse(begin.CeremonyID), body)
+	}
+	stored := func() models.Credential {
+		t.Helper()
+		var c models.Credential
+		if err := db.First(&c, "id_credencial = ?", credential.IDCredencial).Error; err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// Login con verificación de usuario: multifactor y contador guardado
+	authenticator.signCount = 1
+	user, amr, err := login()
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if user.ID != owner.ID {
+		t.Fatalf("logged in as %s, want %s", user.ID, owner.ID)
+	}
+	if len(amr) != 2 || amr[0] != AMRHardwareKey || amr[1] != AMRUserVerified {
+		t.Fatalf("amr = %v, want [%s %s]", amr, AMRHardwareKey, AMRUserVerified)
+	}
+	if c := stored(); c.SignCount != 1 || c.LastUsedAt == nil || c.CloneWarning {
+		t.Fatalf("sign count not persisted: %+v", c)
+	}
+
+	// Una passkey presentada con el user handle de otro usuario no es suya
+	authenticator.signCount = 2
+	authenticator.userHandle = other.ID[:]
+	if _, _, err := login(); !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("credential under another user handle: got %v, want ErrInvalidPasskey", err)
+	}
+	authenticator.userHandle = owner.ID[:]
+
+	// Un contador que no avanza marca la passkey y la deja rechazada
+	authenticator.signCount = 1
+	if _, _, err := login(); !errors.Is(err, ErrPasskeyCloned) {
+		t.Fatalf("stalled counter: got %v, want ErrPasskeyCloned", err)
+	}
+	if !stored().CloneWarning {
+		t.Fatal("clone warning not persisted")
+	}
+	authenticator.signCount = 5
+	if _, _, err := login(); !errors.Is(err, ErrPasskeyCloned) {
+		t.Fatalf("login after clone warning: got %v, want ErrPasskeyCloned", err)
+	}
+}
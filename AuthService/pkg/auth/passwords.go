@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"goServices/pkg/models"
+	"goServices/pkg/notify"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errores de restablecimiento y cambio de contraseña
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrWrongPassword     = errors.New("current password is incorrect")
+	ErrNoLocalAccount    = errors.New("user has no local password")
+)
+
+// PasswordConfig configuración del restablecimiento de contraseña
+type PasswordConfig struct {
+	Sender notify.Sender
+	// ResetURL página del frontend que recibe ?token= y llama a /auth/password/reset
+	ResetURL string
+	// ResetTTL vida del enlace de restablecimiento (1h por defecto)
+	ResetTTL time.Duration
+	// ResendInterval espera mínima entre dos enlaces al mismo usuario (60s por defecto)
+	ResendInterval time.Duration
+}
+
+// PasswordService restablece y cambia contraseñas de cuentas locales
+type PasswordService struct {
+	db     *gorm.DB
+	tokens *TokenService
+	cfg    PasswordConfig
+}
+
+// NewPasswordService crea el servicio de contraseñas
+func NewPasswordService(db *gorm.DB, tokens *TokenService, cfg PasswordConfig) *PasswordService {
+	if cfg.ResetTTL == 0 {
+		cfg.ResetTTL = time.Hour
+	}
+	if cfg.ResendInterval == 0 {
+		cfg.ResendInterval = time.Minute
+	}
+	return &PasswordService{db: db, tokens: tokens, cfg: cfg}
+}
+
+// RequestReset envía un enlace de restablecimiento al email. No revela si la
+// cuenta existe: sin cuenta, o dentro del intervalo de reenvío, no envía nada.
+func (s *PasswordService) RequestReset(ctx context.Context, email string) error {
+	var cuenta models.CuentaLocal
+	if err := s.db.First(&cuenta, "email = ?", email).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	var recent int64
+	if err := s.db.Model(&models.TokenRestablecimiento{}).
+		Where("id_usuario = ? AND created_at > ?", cuenta.IDUsuario, time.Now().Add(-s.cfg.ResendInterval)).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	// Un enlace nuevo invalida los anteriores
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id_usuario = ? AND used_at IS NULL", cuenta.IDUsuario).
+			Delete(&models.TokenRestablecimiento{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TokenRestablecimiento{
+			IDToken:   uuid.New(),
+			IDUsuario: cuenta.IDUsuario,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(s.cfg.ResetTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.cfg.ResetURL + "?" + url.Values{"token": {token}}.Encode()
+	return s.cfg.Sender.Send(ctx, notify.Message{
+		Channel: notify.ChannelEmail,
+		To:      cuenta.Email,
+		Subject: "Restablece tu contraseña",
+		Body: fmt.Sprintf("Para elegir una contraseña nueva abre este enlace (vence en %d minutos):\n%s\n\n"+
+			"Si no lo pediste, ignora este mensaje.", int(s.cfg.ResetTTL.Minutes()), link),
+	})
+}
+
+// Reset fija la contraseña nueva con un token de un solo uso y revoca todas las
+// sesiones del usuario. El email queda verificado: el enlace llegó a su buzón.
+func (s *PasswordService) Reset(ctx context.Context, token, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var cuenta models.CuentaLocal
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var rt models.TokenRestablecimiento
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).
+			First(&rt).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&rt).Update("used_at", &now).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&cuenta, "id_usuario = ?", rt.IDUsuario).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		if err := tx.Model(&cuenta).Update("password_hash", hash).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verificado_at IS NULL", rt.IDUsuario).
+			Update("email_verificado_at", &now).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.tokens.RevokeUserSessions(cuenta.IDUsuario, uuid.Nil, models.RevocadaPassword); err != nil {
+		return err
+	}
+
+	s.notifyChanged(ctx, cuenta.Email)
+	return nil
+}
+
+// Change cambia la contraseña validando la actual y revoca las demás sesiones
+// del usuario; la sesión keep (la de la petición) sigue activa
+func (s *PasswordService) Change(ctx context.Context, userID, keep uuid.UUID, current, password string) error {
+	var cuenta models.CuentaLocal
+	if err := s.db.First(&cuenta, "id_usuario = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrNoLocalAccount
+		}
+		return err
+	}
+
+	ok, err := VerifyPassword(current, cuenta.PasswordHash)
+	if err != nil || !ok {
+		return ErrWrongPassword
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Model(&cuenta).Update("password_hash", hash).Error; err != nil {
+		return err
+	}
+
+	if _, err := s.tokens.RevokeUserSessions(userID, keep, models.RevocadaPassword); err != nil {
+		return err
+	}
+
+	s.notifyChanged(ctx, cuenta.Email)
+	return nil
+}
+
+// Cleanup borra los tokens de restablecimiento vencidos
+func (s *PasswordService) Cleanup() error {
+	return s.db.Where("expires_at < ?", time.Now()).Delete(&models.TokenRestablecimiento{}).Error
+}
+
+// notifyChanged avisa por email del cambio de contraseña; un fallo no revierte el cambio
+func (s *PasswordService) notifyChanged(ctx context.Context, email string) {
+	err := s.cfg.Sender.Send(ctx, notify.Message{
+		Channel: notify.ChannelEmail,
+		To:      email,
+		Subject: "Tu contraseña fue cambiada",
+		Body:    "La contraseña de tu cuenta fue cambiada y se cerraron tus otras sesiones. Si no fuiste tú, restablécela de inmediato.",
+	})
+	if err != nil {
+		log.Printf("Warning: failed to queue password change notice for %s: %v", email, err)
+	}
+}
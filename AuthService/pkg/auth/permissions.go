@@ -0,0 +1,517 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Permisos conocidos, con la forma recurso:acción
+const (
+	PermAll                  = "*"
+	PermUsersRead            = "users:read"
+	PermUsersWrite           = "users:write"
+	PermRolesManage          = "roles:manage"
+	PermSessionsManage       = "sessions:manage"
+	PermTransportistasRead   = "transportistas:read"
+	PermTransportistasVerify = "transportistas:verify"
+)
+
+// Permissions catálogo de permisos que se pueden conceder a un rol; solo incluye
+// los que alguna ruta comprueba
+var Permissions = []string{
+	PermUsersRead,
+	PermUsersWrite,
+	PermRolesManage,
+	PermSessionsManage,
+	PermTransportistasRead,
+	PermTransportistasVerify,
+}
+
+// Errores de gestión de roles
+var (
+	ErrInvalidRoleName   = errors.New("role name must be 3-50 lowercase letters, digits, - or _")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleNotAssigned   = errors.New("role not assigned to user")
+	ErrSystemRole        = errors.New("system roles cannot be modified or assigned")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrRoleUserNotFound  = errors.New("user not found")
+	ErrOwnRoleChange     = errors.New("cannot assign roles to yourself")
+	ErrPermissionGrant   = errors.New("cannot grant or change permissions you do not hold")
+)
+
+// roleNamePattern nombres de rol legibles (p. ej. soporte, finanzas)
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{2,49}$`)
+
+// systemRoles roles de users.rol; admin tiene todos los permisos
+var systemRoles = []models.RolUsuario{models.RolCliente, models.RolTransportista, models.RolAdmin}
+
+// PermissionSet permisos efectivos de un usuario
+type PermissionSet map[string]struct{}
+
+// NewPermissionSet crea el conjunto con los permisos dados
+func NewPermissionSet(perms ...string) PermissionSet {
+	set := PermissionSet{}
+	for _, p := range perms {
+		set[p] = struct{}{}
+	}
+	return set
+}
+
+// Has indica si el conjunto concede perm, directamente, con recurso:* o con *
+func (s PermissionSet) Has(perm string) bool {
+	if _, ok := s[perm]; ok {
+		return true
+	}
+	if _, ok := s[PermAll]; ok {
+		return true
+	}
+	if resource, _, found := strings.Cut(perm, ":"); found {
+		_, ok := s[resource+":*"]
+		return ok
+	}
+	return false
+}
+
+// coversPermissions indica si el actor tiene todos los permisos del conjunto
+func coversPermissions(actor *Principal, perms PermissionSet) bool {
+	for p := range perms {
+		if !actor.HasPermission(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// List permisos del conjunto, ordenados
+func (s PermissionSet) List() []string {
+	list := make([]string, 0, len(s))
+	for p := range s {
+		list = append(list, p)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// PermissionResolver resuelve los permisos efectivos de un usuario a partir de
+// sus roles (users.rol o token) y de los roles personalizados asignados
+type PermissionResolver interface {
+	Resolve(userID uuid.UUID, roles []string) (PermissionSet, error)
+}
+
+// PermissionService guarda roles y permisos en la base y los resuelve con caché
+// en memoria por TTL. Los cambios hechos en esta instancia invalidan la caché
+// al momento; los de otras instancias se ven al vencer el TTL.
+type PermissionService struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu           sync.RWMutex
+	rolePerms    map[string][]string
+	rolesExpires time.Time
+	assigned     map[uuid.UUID]roleEntry
+}
+
+// NewPermissionService crea el servicio de permisos
+func NewPermissionService(db *gorm.DB, ttl time.Duration) *PermissionService {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return &PermissionService{
+		db:       db,
+		ttl:      ttl,
+		assigned: make(map[uuid.UUID]roleEntry),
+	}
+}
+
+// SeedSystemRoles crea los roles de sistema si no existen y garantiza que admin
+// conserve todos los permisos
+func (s *PermissionService) SeedSystemRoles() error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, role := range systemRoles {
+			rol := models.Rol{Nombre: string(role), Sistema: true}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rol).Error; err != nil {
+				return err
+			}
+		}
+		admin := models.RolPermiso{Rol: string(models.RolAdmin), Permiso: PermAll}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&admin).Error
+	})
+}
+
+// Resolve une los permisos de roles y de los roles asignados al usuario
+func (s *PermissionService) Resolve(userID uuid.UUID, roles []string) (PermissionSet, error) {
+	assigned, err := s.UserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+	rolePerms, err := s.rolePermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	set := PermissionSet{}
+	for _, list := range [][]string{roles, assigned} {
+		for _, role := range list {
+			for _, p := range rolePerms[role] {
+				set[p] = struct{}{}
+			}
+		}
+	}
+	return set, nil
+}
+
+// UserRoles roles personalizados asignados al usuario
+func (s *PermissionService) UserRoles(userID uuid.UUID) ([]string, error) {
+	s.mu.RLock()
+	entry, ok := s.assigned[userID]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.roles, nil
+	}
+
+	roles := []string{}
+	err := s.db.Model(&models.UsuarioRol{}).
+		Where("id_usuario = ?", userID).
+		Order("rol").
+		Pluck("rol", &roles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.assigned[userID] = roleEntry{roles: roles, expires: time.Now().Add(s.ttl)}
+	s.mu.Unlock()
+
+	return roles, nil
+}
+
+// rolePermissions permisos de todos los roles; la tabla es pequeña y se cachea entera
+func (s *PermissionService) rolePermissions() (map[string][]string, error) {
+	s.mu.RLock()
+	perms, expires := s.rolePerms, s.rolesExpires
+	s.mu.RUnlock()
+	if perms != nil && time.Now().Before(expires) {
+		return perms, nil
+	}
+
+	var rows []models.RolPermiso
+	if err := s.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	perms = map[string][]string{}
+	for _, row := range rows {
+		perms[row.Rol] = append(perms[row.Rol], row.Permiso)
+	}
+
+	s.mu.Lock()
+	s.rolePerms, s.rolesExpires = perms, time.Now().Add(s.ttl)
+	s.mu.Unlock()
+
+	return perms, nil
+}
+
+// ListRoles roles con sus permisos, por nombre
+func (s *PermissionService) ListRoles() ([]models.RoleResponse, error) {
+	var roles []models.Rol
+	if err := s.db.Order("nombre").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	var rows []models.RolPermiso
+	if err := s.db.Order("permiso").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	perms := map[string][]string{}
+	for _, row := range rows {
+		perms[row.Rol] = append(perms[row.Rol], row.Permiso)
+	}
+
+	list := make([]models.RoleResponse, 0, len(roles))
+	for _, rol := range roles {
+		list = append(list, roleResponse(rol, perms[rol.Nombre]))
+	}
+	return list, nil
+}
+
+// CreateRole crea un rol personalizado con sus permisos; el actor solo puede
+// conceder permisos que tiene
+func (s *PermissionService) CreateRole(actor *Principal, req models.CreateRoleRequest) (*models.RoleResponse, error) {
+	name := strings.TrimSpace(req.Nombre)
+	if !roleNamePattern.MatchString(name) {
+		return nil, ErrInvalidRoleName
+	}
+	perms, err := validatePermissions(req.Permisos)
+	if err != nil {
+		return nil, err
+	}
+	if !coversPermissions(actor, NewPermissionSet(perms...)) {
+		return nil, ErrPermissionGrant
+	}
+
+	rol := models.Rol{Nombre: name, Descripcion: strings.TrimSpace(req.Descripcion)}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Rol{}).Where("nombre = ?", name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRoleExists
+		}
+		if err := tx.Create(&rol).Error; err != nil {
+			return err
+		}
+		return replacePermissions(tx, name, perms)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateRoles()
+	resp := roleResponse(rol, perms)
+	return &resp, nil
+}
+
+// UpdateRole cambia la descripción o reemplaza los permisos del rol. Los de
+// cliente y transportista, que afectan a todos los usuarios, solo los cambia
+// quien tiene todos los permisos; admin no se modifica. En el resto el actor
+// debe tener los permisos que el rol tenía y los que recibe.
+func (s *PermissionService) UpdateRole(actor *Principal, name string, req models.UpdateRoleRequest) (*models.RoleResponse, error) {
+	var perms []string
+	if req.Permisos != nil {
+		if name == string(models.RolAdmin) {
+			return nil, ErrSystemRole
+		}
+		var err error
+		if perms, err = validatePermissions(*req.Permisos); err != nil {
+			return nil, err
+		}
+	}
+
+	var rol models.Rol
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&rol, "nombre = ?", name).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrRoleNotFound
+			}
+			return err
+		}
+		if req.Descripcion != nil {
+			rol.Descripcion = strings.TrimSpace(*req.Descripcion)
+			if err := tx.Model(&rol).Update("descripcion", rol.Descripcion).Error; err != nil {
+				return err
+			}
+		}
+		if req.Permisos != nil {
+			if rol.Sistema && !actor.HasPermission(PermAll) {
+				return ErrPermissionGrant
+			}
+			current, err := permissionsOf(tx, name)
+			if err != nil {
+				return err
+			}
+			if !coversPermissions(actor, NewPermissionSet(append(current, perms...)...)) {
+				return ErrPermissionGrant
+			}
+			return replacePermissions(tx, name, perms)
+		}
+		return tx.Model(&models.RolPermiso{}).Where("rol = ?", name).Order("permiso").Pluck("permiso", &perms).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateRoles()
+	resp := roleResponse(rol, perms)
+	return &resp, nil
+}
+
+// DeleteRole borra un rol personalizado, sus permisos y sus asignaciones; el
+// actor debe tener los permisos del rol
+func (s *PermissionService) DeleteRole(actor *Principal, name string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var rol models.Rol
+		if err := tx.First(&rol, "nombre = ?", name).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrRoleNotFound
+			}
+			return err
+		}
+		if rol.Sistema {
+			return ErrSystemRole
+		}
+		perms, err := permissionsOf(tx, name)
+		if err != nil {
+			return err
+		}
+		if !coversPermissions(actor, NewPermissionSet(perms...)) {
+			return ErrPermissionGrant
+		}
+		if err := tx.Where("rol = ?", name).Delete(&models.UsuarioRol{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("rol = ?", name).Delete(&models.RolPermiso{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&rol).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rolePerms = nil
+	s.assigned = make(map[uuid.UUID]roleEntry)
+	s.mu.Unlock()
+	return nil
+}
+
+// AssignRole asigna un rol personalizado al usuario. Los roles de sistema se
+// cambian en users.rol, no aquí. Nadie se asigna roles a sí mismo y el actor
+// solo puede asignar roles cuyos permisos tiene.
+func (s *PermissionService) AssignRole(actor *Principal, userID uuid.UUID, name string) error {
+	if actor.UserID == userID {
+		return ErrOwnRoleChange
+	}
+
+	var rol models.Rol
+	if err := s.db.First(&rol, "nombre = ?", name).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+	if rol.Sistema {
+		return ErrSystemRole
+	}
+	if err := s.guardRole(actor, name); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrRoleUserNotFound
+	}
+
+	assignment := models.UsuarioRol{IDUsuario: userID, Rol: name, AsignadoPor: actor.UserID}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&assignment).Error; err != nil {
+		return err
+	}
+
+	s.Invalidate(userID)
+	return nil
+}
+
+// UnassignRole quita un rol personalizado al usuario; el actor debe tener los
+// permisos del rol
+func (s *PermissionService) UnassignRole(actor *Principal, userID uuid.UUID, name string) error {
+	if err := s.guardRole(actor, name); err != nil {
+		return err
+	}
+
+	result := s.db.Where("id_usuario = ? AND rol = ?", userID, name).Delete(&models.UsuarioRol{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoleNotAssigned
+	}
+
+	s.Invalidate(userID)
+	return nil
+}
+
+// Invalidate descarta los roles asignados cacheados de un usuario
+func (s *PermissionService) Invalidate(userID uuid.UUID) {
+	s.mu.Lock()
+	delete(s.assigned, userID)
+	s.mu.Unlock()
+}
+
+// guardRole comprueba que el actor tenga todos los permisos del rol
+func (s *PermissionService) guardRole(actor *Principal, name string) error {
+	perms, err := permissionsOf(s.db, name)
+	if err != nil {
+		return err
+	}
+	if !coversPermissions(actor, NewPermissionSet(perms...)) {
+		return ErrPermissionGrant
+	}
+	return nil
+}
+
+// invalidateRoles descarta los permisos por rol cacheados
+func (s *PermissionService) invalidateRoles() {
+	s.mu.Lock()
+	s.rolePerms = nil
+	s.mu.Unlock()
+}
+
+// validatePermissions normaliza la lista y rechaza permisos fuera del catálogo;
+// se admite recurso:* para un recurso conocido, pero no * (reservado a admin)
+func validatePermissions(perms []string) ([]string, error) {
+	list := normalizeList(perms)
+	for _, p := range list {
+		if containsString(Permissions, p) {
+			continue
+		}
+		resource, action, found := strings.Cut(p, ":")
+		if found && action == "*" && knownResource(resource) {
+			continue
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// knownResource indica si algún permiso del catálogo es del recurso dado
+func knownResource(resource string) bool {
+	for _, p := range Permissions {
+		if strings.HasPrefix(p, resource+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// permissionsOf permisos guardados del rol, sin pasar por la caché
+func permissionsOf(db *gorm.DB, role string) ([]string, error) {
+	var perms []string
+	err := db.Model(&models.RolPermiso{}).Where("rol = ?", role).Pluck("permiso", &perms).Error
+	return perms, err
+}
+
+// replacePermissions reemplaza los permisos del rol dentro de la transacción
+func replacePermissions(tx *gorm.DB, role string, perms []string) error {
+	if err := tx.Where("rol = ?", role).Delete(&models.RolPermiso{}).Error; err != nil {
+		return err
+	}
+	for _, p := range perms {
+		if err := tx.Create(&models.RolPermiso{Rol: role, Permiso: p}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roleResponse rol con su lista de permisos, nunca nil en el JSON
+func roleResponse(rol models.Rol, perms []string) models.RoleResponse {
+	if perms == nil {
+		perms = []string{}
+	}
+	return models.RoleResponse{Rol: rol, Permisos: perms}
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// staticResolver resuelve siempre los mismos permisos
+type staticResolver PermissionSet
+
+func (r staticResolver) Resolve(uuid.UUID, []string) (PermissionSet, error) {
+	return PermissionSet(r), nil
+}
+
+func principalWith(perms ...string) *Principal {
+	p := &Principal{UserID: uuid.New()}
+	p.UsePermissions(staticResolver(NewPermissionSet(perms...)))
+	return p
+}
+
+func TestCoversPermissions(t *testing.T) {
+	tests := []struct {
+		name   string
+		actor  *Principal
+		target PermissionSet
+		want   bool
+	}{
+		{"nothing to cover", principalWith(), NewPermissionSet(), true},
+		{"same permissions", principalWith(PermUsersRead, PermSessionsManage), NewPermissionSet(PermSessionsManage), true},
+		{"missing permission", principalWith(PermRolesManage), NewPermissionSet(PermRolesManage, PermUsersWrite), false},
+		{"resource wildcard covers actions", principalWith("users:*"), NewPermissionSet(PermUsersRead, PermUsersWrite), true},
+		{"action does not cover wildcard", principalWith(PermUsersRead, PermUsersWrite), NewPermissionSet("users:*"), false},
+		{"all covers everything", principalWith(PermAll), NewPermissionSet(PermAll, "roles:*"), true},
+		{"wildcard does not cover all", principalWith("users:*", "roles:*", "sessions:*"), NewPermissionSet(PermAll), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coversPermissions(tt.actor, tt.target); got != tt.want {
+				t.Errorf("coversPermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
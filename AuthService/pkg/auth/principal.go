@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// Principal identidad autenticada de la petición
+type Principal struct {
+	UserID    uuid.UUID
+	Email     string
+	Phone     string
+	Roles     []string
+	SessionID string
+
+	// Actor admin que suplanta al usuario; nil fuera de una suplantación
+	Actor *Actor
+	// ImpersonationWrite la suplantación admite acciones de escritura
+	ImpersonationWrite bool
+
+	// Claims verificados de los que se construyó el principal
+	Claims *Claims
+
+	// Permisos resueltos como mucho una vez por petición
+	permissions   PermissionResolver
+	permsOnce     sync.Once
+	permissionSet PermissionSet
+	permsErr      error
+}
+
+// NewPrincipal construye el principal a partir de claims verificados
+func NewPrincipal(claims *Claims) (*Principal, error) {
+	userID, err := uuid.Parse(claims.Sub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject: %w", err)
+	}
+
+	principal := &Principal{
+		UserID:    userID,
+		Email:     claims.Email,
+		Phone:     claims.Phone,
+		Roles:     rolesFromClaims(claims),
+		SessionID: claims.SessionID,
+		Claims:    claims,
+	}
+
+	if claims.Act != nil {
+		actorID, err := uuid.Parse(claims.Act.Sub)
+		if err != nil {
+			return nil, fmt.Errorf("invalid actor: %w", err)
+		}
+		principal.Actor = &Actor{UserID: actorID, Email: claims.Act.Email}
+		principal.ImpersonationWrite = claims.ImpWrite
+	}
+
+	return principal, nil
+}
+
+// Actor admin que actúa en nombre del principal
+type Actor struct {
+	UserID uuid.UUID
+	Email  string
+}
+
+// IsImpersonated indica si la petición la hace un admin suplantando al usuario
+func (p *Principal) IsImpersonated() bool {
+	return p.Actor != nil
+}
+
+// HasRole indica si el principal tiene el rol dado
+func (p *Principal) HasRole(role models.RolUsuario) bool {
+	for _, r := range p.Roles {
+		if r == string(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyRole indica si el principal tiene alguno de los roles dados
+func (p *Principal) HasAnyRole(roles ...models.RolUsuario) bool {
+	for _, role := range roles {
+		if p.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasMFA indica si el token se obtuvo con segundo factor (aal2)
+func (p *Principal) HasMFA() bool {
+	return p.Claims != nil && p.Claims.Aal == AAL2
+}
+
+// IsAdmin atajo para HasRole(models.RolAdmin)
+func (p *Principal) IsAdmin() bool {
+	return p.HasRole(models.RolAdmin)
+}
+
+// UsePermissions indica cómo resolver los permisos del principal
+func (p *Principal) UsePermissions(resolver PermissionResolver) {
+	p.permissions = resolver
+}
+
+// Permissions permisos efectivos del principal. Se resuelven en la primera
+// llamada y se reutilizan el resto de la petición; sin resolver, admin tiene
+// todos y los demás ninguno.
+func (p *Principal) Permissions() (PermissionSet, error) {
+	p.permsOnce.Do(func() {
+		if p.permissions == nil {
+			p.permissionSet = NewPermissionSet()
+			if p.IsAdmin() {
+				p.permissionSet = NewPermissionSet(PermAll)
+			}
+			return
+		}
+		p.permissionSet, p.permsErr = p.permissions.Resolve(p.UserID, p.Roles)
+	})
+	return p.permissionSet, p.permsErr
+}
+
+// HasPermission indica si el principal tiene el permiso; un error al
+// resolverlos cuenta como no tenerlo
+func (p *Principal) HasPermission(perm string) bool {
+	set, err := p.Permissions()
+	return err == nil && set.Has(perm)
+}
+
+// ServicePrincipal servicio interno autenticado con un token de client
+// credentials, o integración autenticada con una clave API
+type ServicePrincipal struct {
+	ClientID string
+	Scopes   []string
+
+	// Claims verificados del token de servicio; nil con clave API
+	Claims *Claims
+	// APIKeyID clave API usada; uuid.Nil con token de servicio
+	APIKeyID uuid.UUID
+}
+
+// NewServicePrincipal construye el principal de servicio a partir de claims verificados
+func NewServicePrincipal(claims *Claims) *ServicePrincipal {
+	return &ServicePrincipal{
+		ClientID: claims.ClientID,
+		Scopes:   strings.Fields(claims.Scope),
+		Claims:   claims,
+	}
+}
+
+// HasScope indica si el token del servicio incluye el scope dado
+func (s *ServicePrincipal) HasScope(scope string) bool {
+	return containsString(s.Scopes, scope)
+}
+
+// rolesFromClaims lee los roles de aplicación desde app_metadata.
+// Se aceptan app_metadata.roles (arreglo) y app_metadata.rol / app_metadata.role
+// (string); el claim role de Supabase ("authenticated") no es un rol de aplicación.
+func rolesFromClaims(claims *Claims) []string {
+	roles := []string{}
+	seen := map[string]bool{}
+	add := func(v interface{}) {
+		if r, ok := v.(string); ok && r != "" && !seen[r] {
+			seen[r] = true
+			roles = append(roles, r)
+		}
+	}
+
+	if list, ok := claims.AppMetadata["roles"].([]interface{}); ok {
+		for _, r := range list {
+			add(r)
+		}
+	}
+	add(claims.AppMetadata["rol"])
+	add(claims.AppMetadata["role"])
+
+	return roles
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errores de perfiles de cliente
+var (
+	ErrProfileNotFound  = errors.New("client profile not found")
+	ErrDocumentoTaken   = errors.New("documento_identidad already registered")
+	ErrTelefonoTaken    = errors.New("telefono already registered")
+	ErrInvalidTelefono  = errors.New("invalid phone number")
+	ErrInvalidDocumento = errors.New("invalid documento_identidad")
+)
+
+// phonePattern teléfono ya normalizado: 7 a 15 dígitos con + opcional
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// ProfileConfig configuración de perfiles de cliente
+type ProfileConfig struct {
+	// AutoCreate crea un perfil vacío la primera vez que el usuario lo necesita
+	AutoCreate bool
+}
+
+// ProfileService alta y actualización del perfil de cliente (documento y teléfono)
+type ProfileService struct {
+	db  *gorm.DB
+	cfg ProfileConfig
+}
+
+// NewProfileService crea el servicio de perfiles
+func NewProfileService(db *gorm.DB, cfg ProfileConfig) *ProfileService {
+	return &ProfileService{db: db, cfg: cfg}
+}
+
+// Get perfil del usuario; con AutoCreate lo crea vacío si no existe
+func (s *ProfileService) Get(userID uuid.UUID) (*models.PerfilCliente, error) {
+	var perfil models.PerfilCliente
+	err := s.db.First(&perfil, "id_usuario = ?", userID).Error
+	if err == nil {
+		return &perfil, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	if !s.cfg.AutoCreate {
+		return nil, ErrProfileNotFound
+	}
+
+	// Dos peticiones simultáneas pueden crearlo a la vez; la segunda no inserta
+	// nada y lee el perfil de la primera
+	perfil = models.PerfilCliente{IDPerfil: uuid.New(), IDUsuario: userID}
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id_usuario"}},
+		DoNothing: true,
+	}).Create(&perfil).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.First(&perfil, "id_usuario = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return &perfil, nil
+}
+
+// EnsurePhoneIndex crea el índice único de teléfonos verificados: el login por
+// SMS necesita que un teléfono verificado identifique a un único usuario
+func (s *ProfileService) EnsurePhoneIndex() error {
+	return s.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_perfiles_telefono_verificado ON perfil_clientes (telefono) " +
+		"WHERE telefono_verificado_at IS NOT NULL AND telefono <> ''").Error
+}
+
+// Save crea el perfil si no existe (create, o AutoCreate) y aplica los campos
+// enviados; repetir la misma petición deja el perfil igual. Devuelve si se creó.
+func (s *ProfileService) Save(userID uuid.UUID, req models.ProfileRequest, create bool) (*models.PerfilCliente, bool, error) {
+	documento, telefono, err := normalizeProfile(req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	perfil, created, err := s.save(userID, req, documento, telefono, create)
+	// Otra petición creó el perfil o tomó el documento a la vez; al reintentar se
+	// actualiza el perfil ya creado o se detecta el documento en uso
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		perfil, created, err = s.save(userID, req, documento, telefono, create)
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, false, ErrDocumentoTaken
+	}
+	return perfil, created, err
+}
+
+// save aplica la petición ya normalizada dentro de una transacción
+func (s *ProfileService) save(userID uuid.UUID, req models.ProfileRequest, documento *string, telefono string, create bool) (*models.PerfilCliente, bool, error) {
+	var perfil models.PerfilCliente
+	created := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&perfil, "id_usuario = ?", userID).Error
+		if err == gorm.ErrRecordNotFound {
+			if !create && !s.cfg.AutoCreate {
+				return ErrProfileNotFound
+			}
+			perfil = models.PerfilCliente{IDPerfil: uuid.New(), IDUsuario: userID}
+			created = true
+		} else if err != nil {
+			return err
+		}
+
+		if req.DocumentoIdentidad != nil {
+			if documento != nil {
+				var count int64
+				err := tx.Model(&models.PerfilCliente{}).
+					Where("documento_identidad = ? AND id_usuario <> ?", *documento, userID).
+					Count(&count).Error
+				if err != nil {
+					return err
+				}
+				if count > 0 {
+					return ErrDocumentoTaken
+				}
+			}
+			perfil.DocumentoIdentidad = documento
+		}
+
+		// Un teléfono nuevo queda sin verificar; la unicidad se exige al
+		// verificarlo, así nadie bloquea un número ajeno con solo escribirlo
+		if req.Telefono != nil && telefono != perfil.Telefono {
+			perfil.Telefono = telefono
+			perfil.TelefonoVerificadoAt = nil
+		}
+
+		if created {
+			return tx.Create(&perfil).Error
+		}
+		return tx.Save(&perfil).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &perfil, created, nil
+}
+
+// storedPhone expresión SQL equivalente a NormalizePhone sobre perfil_clientes.telefono
+const storedPhone = `regexp_replace(regexp_replace(telefono, '^\s+|\s+$', '', 'g'), '[ .()-]', '', 'g')`
+
+// PhoneCollision teléfono normalizado que varios usuarios tienen verificado
+type PhoneCollision struct {
+	Telefono string
+	// Usuarios ids de los usuarios, separados por comas
+	Usuarios string
+}
+
+// NormalizeStoredPhones migración única para los perfiles guardados antes de
+// normalizar el teléfono al escribirlo, que no coinciden con el destino del
+// login por SMS. Los verificados que chocarían tras normalizarlos (y romperían
+// el índice único parcial) no se tocan y se devuelven para revisarlos a mano.
+func (s *ProfileService) NormalizeStoredPhones() (int64, []PhoneCollision, error) {
+	var updated int64
+	var collisions []PhoneCollision
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PerfilCliente{}).
+			Select(storedPhone + " AS telefono, string_agg(id_usuario::text, ',' ORDER BY id_usuario) AS usuarios").
+			Where("telefono_verificado_at IS NOT NULL AND telefono <> ''").
+			Group(storedPhone).
+			Having("count(*) > 1").
+			Scan(&collisions).Error; err != nil {
+			return err
+		}
+
+		query := tx.Model(&models.PerfilCliente{}).Where("telefono <> " + storedPhone)
+		if len(collisions) > 0 {
+			phones := make([]string, len(collisions))
+			for i, c := range collisions {
+				phones[i] = c.Telefono
+			}
+			query = query.Where("NOT (telefono_verificado_at IS NOT NULL AND "+storedPhone+" IN ?)", phones)
+		}
+		result := query.UpdateColumn("telefono", gorm.Expr(storedPhone))
+		updated = result.RowsAffected
+		return result.Error
+	})
+	return updated, collisions, err
+}
+
+// ensurePhoneAvailable devuelve ErrTelefonoTaken si otro usuario ya verificó el teléfono
+func ensurePhoneAvailable(db *gorm.DB, userID uuid.UUID, phone string) error {
+	var count int64
+	err := db.Model(&models.PerfilCliente{}).
+		Where("telefono = ? AND telefono_verificado_at IS NOT NULL AND id_usuario <> ?", phone, userID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTelefonoTaken
+	}
+	return nil
+}
+
+// normalizeProfile limpia el documento (vacío = nulo) y normaliza el teléfono
+func normalizeProfile(req models.ProfileRequest) (*string, string, error) {
+	var documento *string
+	if req.DocumentoIdentidad != nil {
+		value := strings.TrimSpace(*req.DocumentoIdentidad)
+		if len(value) > 32 {
+			return nil, "", ErrInvalidDocumento
+		}
+		if value != "" {
+			documento = &value
+		}
+	}
+
+	var telefono string
+	if req.Telefono != nil {
+		telefono = NormalizePhone(*req.Telefono)
+		if telefono != "" && !phonePattern.MatchString(telefono) {
+			return nil, "", ErrInvalidTelefono
+		}
+	}
+	return documento, telefono, nil
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTokenRevoked el token fue revocado antes de su expiración
+var ErrTokenRevoked = errors.New("token revoked")
+
+// RevocationStore lista de tokens revocados que AuthMiddleware consulta en cada petición
+type RevocationStore interface {
+	// RevokeToken revoca un token por jti hasta su expiración
+	RevokeToken(jti string, expiresAt time.Time) error
+	// RevokeUserBefore revoca todos los tokens del usuario emitidos antes de before
+	RevokeUserBefore(userID uuid.UUID, before time.Time) error
+	// IsRevoked indica si los claims corresponden a un token revocado
+	IsRevoked(claims *Claims) (bool, error)
+	// Cleanup purga las entradas cuyos tokens ya expiraron
+	Cleanup() error
+}
+
+// StartRevocationCleanup purga periódicamente el store hasta que ctx se cancele
+func StartRevocationCleanup(ctx context.Context, store RevocationStore, interval time.Duration) {
+	StartCleanup(ctx, "revocation", store, interval)
+}
+
+// MemoryRevocationStore store en memoria; solo sirve con una única instancia
+type MemoryRevocationStore struct {
+	// maxTokenTTL vida máxima de un token: pasado before+maxTokenTTL ya no
+	// queda ningún token afectado por una revocación por usuario
+	maxTokenTTL time.Duration
+
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[uuid.UUID]time.Time
+}
+
+// NewMemoryRevocationStore crea un store en memoria
+func NewMemoryRevocationStore(maxTokenTTL time.Duration) *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		maxTokenTTL: maxTokenTTL,
+		tokens:      make(map[string]time.Time),
+		users:       make(map[uuid.UUID]time.Time),
+	}
+}
+
+// RevokeToken revoca un token por jti
+func (s *MemoryRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	s.tokens[jti] = expiresAt
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeUserBefore revoca los tokens del usuario emitidos antes de before
+func (s *MemoryRevocationStore) RevokeUserBefore(userID uuid.UUID, before time.Time) error {
+	// iat tiene resolución de segundos
+	before = before.Truncate(time.Second)
+
+	s.mu.Lock()
+	if current, ok := s.users[userID]; !ok || before.After(current) {
+		s.users[userID] = before
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// IsRevoked consulta jti y corte por usuario
+func (s *MemoryRevocationStore) IsRevoked(claims *Claims) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if claims.Jti != "" {
+		if _, ok := s.tokens[claims.Jti]; ok {
+			return true, nil
+		}
+	}
+
+	if userID, err := uuid.Parse(claims.Sub); err == nil {
+		if before, ok := s.users[userID]; ok && claims.Iat < before.Unix() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Cleanup purga entradas vencidas
+func (s *MemoryRevocationStore) Cleanup() error {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for jti, expiresAt := range s.tokens {
+		if now.After(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for userID, before := range s.users {
+		if now.After(before.Add(s.maxTokenTTL)) {
+			delete(s.users, userID)
+		}
+	}
+	return nil
+}
+
+// PostgresRevocationStore store persistente compartido entre instancias
+type PostgresRevocationStore struct {
+	db          *gorm.DB
+	maxTokenTTL time.Duration
+}
+
+// NewPostgresRevocationStore crea un store sobre las tablas tokens_revocados y revocaciones_usuario
+func NewPostgresRevocationStore(db *gorm.DB, maxTokenTTL time.Duration) *PostgresRevocationStore {
+	return &PostgresRevocationStore{db: db, maxTokenTTL: maxTokenTTL}
+}
+
+// RevokeToken revoca un token por jti
+func (s *PostgresRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.TokenRevocado{
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+	}).Error
+}
+
+// RevokeUserBefore revoca los tokens del usuario emitidos antes de before
+func (s *PostgresRevocationStore) RevokeUserBefore(userID uuid.UUID, before time.Time) error {
+	// iat tiene resolución de segundos
+	before = before.Truncate(time.Second)
+
+	// Como en memoria, se conserva el corte más reciente: un before anterior no
+	// puede devolver la validez a tokens ya revocados
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id_usuario"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"revoked_before": gorm.Expr("GREATEST(revocaciones_usuario.revoked_before, EXCLUDED.revoked_before)"),
+			"expires_at":     gorm.Expr("GREATEST(revocaciones_usuario.expires_at, EXCLUDED.expires_at)"),
+			"updated_at":     gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).Create(&models.RevocacionUsuario{
+		IDUsuario:     userID,
+		RevokedBefore: before,
+		ExpiresAt:     before.Add(s.maxTokenTTL),
+	}).Error
+}
+
+// IsRevoked consulta jti y corte por usuario
+func (s *PostgresRevocationStore) IsRevoked(claims *Claims) (bool, error) {
+	if claims.Jti != "" {
+		var count int64
+		if err := s.db.Model(&models.TokenRevocado{}).Where("jti = ?", claims.Jti).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	userID, err := uuid.Parse(claims.Sub)
+	if err != nil {
+		return false, nil
+	}
+
+	var count int64
+	if err := s.db.Model(&models.RevocacionUsuario{}).
+		Where("id_usuario = ? AND revoked_before > ?", userID, time.Unix(claims.Iat, 0)).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Cleanup purga entradas vencidas
+func (s *PostgresRevocationStore) Cleanup() error {
+	now := time.Now()
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.TokenRevocado{}).Error; err != nil {
+		return err
+	}
+	return s.db.Where("expires_at < ?", now).Delete(&models.RevocacionUsuario{}).Error
+}
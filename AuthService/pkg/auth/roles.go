@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RoleResolver resuelve los roles de un usuario cuando el token no los incluye
+type RoleResolver interface {
+	Roles(userID uuid.UUID) ([]string, error)
+}
+
+// roleEntry roles y estado cacheados de un usuario
+type roleEntry struct {
+	roles    []string
+	disabled bool
+	expires  time.Time
+}
+
+// RoleCache resuelve roles desde users.rol, y si la cuenta está desactivada,
+// con caché en memoria por TTL
+type RoleCache struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[uuid.UUID]roleEntry
+}
+
+// NewRoleCache crea la caché de roles
+func NewRoleCache(db *gorm.DB, ttl time.Duration) *RoleCache {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return &RoleCache{
+		db:      db,
+		ttl:     ttl,
+		entries: make(map[uuid.UUID]roleEntry),
+	}
+}
+
+// Roles devuelve los roles del usuario, consultando la base si no están en caché
+func (rc *RoleCache) Roles(userID uuid.UUID) ([]string, error) {
+	entry, err := rc.entry(userID)
+	if err != nil {
+		return nil, err
+	}
+	return entry.roles, nil
+}
+
+// Disabled indica si la cuenta del usuario está desactivada; un usuario que no
+// existe en users (p. ej. aún no sincronizado desde Supabase) no lo está
+func (rc *RoleCache) Disabled(userID uuid.UUID) (bool, error) {
+	entry, err := rc.entry(userID)
+	if err != nil {
+		return false, err
+	}
+	return entry.disabled, nil
+}
+
+// entry devuelve la entrada cacheada del usuario o la carga de la base
+func (rc *RoleCache) entry(userID uuid.UUID) (roleEntry, error) {
+	rc.mu.RLock()
+	entry, ok := rc.entries[userID]
+	rc.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry, nil
+	}
+
+	var user models.User
+	if err := rc.db.Select("id", "rol", "desactivado_at").First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return roleEntry{roles: []string{}}, nil
+		}
+		return roleEntry{}, err
+	}
+
+	entry = roleEntry{roles: []string{}, disabled: user.DesactivadoAt != nil, expires: time.Now().Add(rc.ttl)}
+	if user.Rol != "" {
+		entry.roles = append(entry.roles, user.Rol)
+	}
+
+	rc.mu.Lock()
+	rc.entries[userID] = entry
+	rc.mu.Unlock()
+
+	return entry, nil
+}
+
+// Invalidate descarta los datos cacheados de un usuario (p. ej. tras cambiar su
+// rol o desactivarlo)
+func (rc *RoleCache) Invalidate(userID uuid.UUID) {
+	rc.mu.Lock()
+	delete(rc.entries, userID)
+	rc.mu.Unlock()
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// Signer firma tokens propios con ES256
+type Signer struct {
+	key *ecdsa.PrivateKey
+	kid string
+}
+
+// NewSigner crea un firmante con la clave dada; el kid es su thumbprint RFC 7638
+func NewSigner(key *ecdsa.PrivateKey) *Signer {
+	s := &Signer{key: key}
+	s.kid = s.thumbprint()
+	return s
+}
+
+// GenerateSigner crea un firmante con una clave P-256 efímera
+func GenerateSigner() (*Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(key), nil
+}
+
+// LoadSigner lee una clave privada P-256 en PEM (SEC 1 o PKCS#8)
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key: no PEM block found")
+	}
+
+	var key *ecdsa.PrivateKey
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed interface{}
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = parsed.(*ecdsa.PrivateKey); !ok {
+				err = fmt.Errorf("not an ECDSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("signing key: ES256 requires a P-256 key")
+	}
+
+	return NewSigner(key), nil
+}
+
+// Kid identificador de la clave
+func (s *Signer) Kid() string {
+	return s.kid
+}
+
+// Sign serializa los claims y los firma como JWT ES256
+func (s *Signer) Sign(claims interface{}) (string, error) {
+	hdr, err := json.Marshal(header{Alg: AlgES256, Kid: s.kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(hdr) + "." + encodeSegment(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	// JWS codifica la firma ECDSA como r||s de tamaño fijo
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// PublicKey clave pública del firmante
+func (s *Signer) PublicKey() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+// JWK clave pública del firmante en formato JWK
+func (s *Signer) JWK() JWK {
+	return JWK{
+		Kty: "EC",
+		Kid: s.kid,
+		Use: "sig",
+		Alg: AlgES256,
+		Crv: "P-256",
+		X:   encodeSegment(s.key.X.FillBytes(make([]byte, 32))),
+		Y:   encodeSegment(s.key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// KeySet KeySet con la clave pública del firmante, para verificar sus tokens
+func (s *Signer) KeySet() *KeySet {
+	return &KeySet{keys: map[string]crypto.PublicKey{s.kid: s.PublicKey()}}
+}
+
+// thumbprint calcula el thumbprint JWK (RFC 7638) de la clave pública
+func (s *Signer) thumbprint() string {
+	jwk := s.JWK()
+	// Miembros requeridos en orden lexicográfico
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// encodeSegment codifica un segmento JWT en base64 URL-safe sin padding
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,393 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Audiencia y duración del token de desafío MFA
+const (
+	mfaAudience     = "mfa"
+	mfaChallengeTTL = 5 * time.Minute
+)
+
+// Errores de refresh y sesión
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrSessionRevoked      = errors.New("session revoked")
+)
+
+// TokenServiceConfig configuración de la emisión de tokens propios
+type TokenServiceConfig struct {
+	// Keys claves de firma; la activa firma los access tokens
+	Keys *KeyRing
+	// Issuer valor del claim iss de los tokens propios
+	Issuer string
+	// Audience valor del claim aud; "authenticated" para compatibilidad con Supabase
+	Audience string
+	// AccessTTL duración de los access tokens
+	AccessTTL time.Duration
+	// RefreshTTL duración de los refresh tokens
+	RefreshTTL time.Duration
+}
+
+// TokenService emite access tokens firmados y refresh tokens opacos
+type TokenService struct {
+	db     *gorm.DB
+	cfg    TokenServiceConfig
+	logins LoginRecorder
+}
+
+// LoginRecorder recibe cada login completado (sesión nueva)
+type LoginRecorder interface {
+	RecordLogin(user *models.User, sessionID uuid.UUID, device models.DeviceInfo, amr []string)
+}
+
+// UseLoginRecorder registra en r cada sesión que abra IssuePair
+func (s *TokenService) UseLoginRecorder(r LoginRecorder) {
+	s.logins = r
+}
+
+// NewTokenService crea el servicio de tokens
+func NewTokenService(db *gorm.DB, cfg TokenServiceConfig) *TokenService {
+	if cfg.Audience == "" {
+		cfg.Audience = "authenticated"
+	}
+	if cfg.AccessTTL <= 0 {
+		cfg.AccessTTL = 15 * time.Minute
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = 30 * 24 * time.Hour
+	}
+	return &TokenService{db: db, cfg: cfg}
+}
+
+// Verifier verificador para los access tokens emitidos por este servicio
+func (s *TokenService) Verifier() *Verifier {
+	return NewVerifier(VerifierConfig{
+		Keys:     s.cfg.Keys,
+		Audience: []string{s.cfg.Audience},
+		Issuer:   s.cfg.Issuer,
+		Leeway:   30 * time.Second,
+	})
+}
+
+// IssuePair abre una sesión nueva para el usuario y emite su primer par de tokens
+// amr lista los métodos de autenticación usados (p. ej. pwd, totp). Las cuentas
+// desactivadas devuelven ErrAccountDisabled.
+func (s *TokenService) IssuePair(user *models.User, email string, device models.DeviceInfo, amr []string) (*models.TokenResponse, error) {
+	if user.DesactivadoAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	now := time.Now()
+	session := models.Session{
+		IDSesion:    uuid.New(),
+		IDUsuario:   user.ID,
+		Dispositivo: device.Dispositivo,
+		UserAgent:   device.UserAgent,
+		IP:          device.IP,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(s.cfg.RefreshTTL),
+		AMR:         strings.Join(amr, ","),
+	}
+
+	var refresh string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		var err error
+		refresh, err = s.newRefreshToken(tx, session.IDSesion)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.logins != nil {
+		s.logins.RecordLogin(user, session.IDSesion, device, amr)
+	}
+
+	return s.respond(user, email, &session, refresh)
+}
+
+// Refresh rota el refresh token: el presentado queda usado y se emite uno nuevo
+// en la misma sesión. Presentar un token ya rotado revoca la sesión completa.
+func (s *TokenService) Refresh(refreshToken string, device models.DeviceInfo) (*models.TokenResponse, error) {
+	var user models.User
+	var email string
+	var refresh string
+	var session models.Session
+	reused := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var stored models.RefreshToken
+		if err := tx.First(&stored, "token_hash = ?", hashToken(refreshToken)).Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(&session, "id_sesion = ?", stored.IDSesion).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// Marcado condicional: si dos peticiones usan el mismo token a la vez,
+		// solo una consigue rotarlo y la otra se trata como reuso
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id_refresh_token = ? AND used_at IS NULL", stored.IDRefreshToken).
+			Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		updates := map[string]interface{}{"last_used_at": now}
+		if device.IP != "" {
+			updates["ip"] = device.IP
+		}
+		if device.UserAgent != "" {
+			updates["user_agent"] = device.UserAgent
+		}
+		if err := tx.Model(&session).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, "id = ?", session.IDUsuario).Error; err != nil {
+			return err
+		}
+		if user.DesactivadoAt != nil {
+			return ErrAccountDisabled
+		}
+
+		var cuenta models.CuentaLocal
+		if err := tx.First(&cuenta, "id_usuario = ?", user.ID).Error; err == nil {
+			email = cuenta.Email
+		}
+
+		var err error
+		refresh, err = s.newRefreshToken(tx, session.IDSesion)
+		return err
+	})
+	if err != nil {
+		if reused {
+			// Un token rotado vuelve a usarse: puede haber sido robado, se revoca
+			// toda la familia (fuera de la transacción fallida)
+			if revokeErr := s.RevokeSession(session.IDSesion, models.RevocadaReuso); revokeErr != nil {
+				return nil, revokeErr
+			}
+			return nil, ErrRefreshTokenReused
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	return s.respond(&user, email, &session, refresh)
+}
+
+// Revoke revoca la sesión a la que pertenece el refresh token (logout)
+func (s *TokenService) Revoke(refreshToken string) error {
+	var stored models.RefreshToken
+	if err := s.db.First(&stored, "token_hash = ?", hashToken(refreshToken)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	return s.RevokeSession(stored.IDSesion, models.RevocadaLogout)
+}
+
+// RevokeSession revoca una sesión y con ella todos sus refresh tokens
+func (s *TokenService) RevokeSession(sessionID uuid.UUID, reason string) error {
+	now := time.Now()
+	return s.db.Model(&models.Session{}).
+		Where("id_sesion = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{"revoked_at": &now, "revoked_reason": reason}).Error
+}
+
+// RevokeUserSessions revoca todas las sesiones activas del usuario excepto except
+// (uuid.Nil para revocarlas todas); devuelve cuántas se revocaron
+func (s *TokenService) RevokeUserSessions(userID, except uuid.UUID, reason string) (int64, error) {
+	now := time.Now()
+	result := s.db.Model(&models.Session{}).
+		Where("id_usuario = ? AND id_sesion <> ? AND revoked_at IS NULL", userID, except).
+		Updates(map[string]interface{}{"revoked_at": &now, "revoked_reason": reason})
+	return result.RowsAffected, result.Error
+}
+
+// ListSessions sesiones activas del usuario, la más reciente primero
+func (s *TokenService) ListSessions(userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.
+		Where("id_usuario = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// FindSession busca una sesión por ID
+func (s *TokenService) FindSession(sessionID uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.First(&session, "id_sesion = ?", sessionID).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ValidateSession rechaza tokens propios cuya sesión fue revocada o venció.
+// Los tokens de otros emisores (Supabase) no tienen sesión local y se aceptan.
+func (s *TokenService) ValidateSession(claims *Claims) error {
+	if claims.Iss != s.cfg.Issuer {
+		return nil
+	}
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+
+	var session models.Session
+	if err := s.db.Select("id_sesion", "revoked_at", "expires_at").
+		First(&session, "id_sesion = ?", sessionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+
+	return nil
+}
+
+// respond firma el access token y arma la respuesta
+func (s *TokenService) respond(user *models.User, email string, session *models.Session, refresh string) (*models.TokenResponse, error) {
+	now := time.Now()
+	var amr AMR
+	if session.AMR != "" {
+		amr = strings.Split(session.AMR, ",")
+	}
+
+	claims := Claims{
+		Sub:         user.ID.String(),
+		Aud:         Audience{s.cfg.Audience},
+		Iss:         s.cfg.Issuer,
+		Iat:         now.Unix(),
+		Exp:         now.Add(s.cfg.AccessTTL).Unix(),
+		Jti:         uuid.NewString(),
+		Role:        "authenticated",
+		Email:       email,
+		SessionID:   session.IDSesion.String(),
+		Amr:         amr,
+		Aal:         aalFor(amr),
+		AppMetadata: map[string]interface{}{"rol": user.Rol},
+	}
+
+	access, err := s.cfg.Keys.Signer().Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.cfg.AccessTTL.Seconds()),
+		SessionID:    session.IDSesion.String(),
+		User:         user,
+	}, nil
+}
+
+// IssueMFAChallenge emite un token de corta duración que acredita el primer
+// factor y solo sirve para completar el login en /auth/2fa/verify
+func (s *TokenService) IssueMFAChallenge(userID uuid.UUID, amr []string) (string, int64, error) {
+	now := time.Now()
+	claims := Claims{
+		Sub: userID.String(),
+		Aud: Audience{mfaAudience},
+		Iss: s.cfg.Issuer,
+		Iat: now.Unix(),
+		Exp: now.Add(mfaChallengeTTL).Unix(),
+		Jti: uuid.NewString(),
+		Amr: AMR(amr),
+	}
+
+	token, err := s.cfg.Keys.Signer().Sign(claims)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, int64(mfaChallengeTTL.Seconds()), nil
+}
+
+// VerifyMFAChallenge valida el token de desafío y devuelve sus claims
+func (s *TokenService) VerifyMFAChallenge(token string) (*Claims, error) {
+	verifier := NewVerifier(VerifierConfig{
+		Keys:     s.cfg.Keys,
+		Audience: []string{mfaAudience},
+		Issuer:   s.cfg.Issuer,
+	})
+	return verifier.Verify(token)
+}
+
+// aalFor nivel de autenticación: aal2 cuando se usó más de un factor
+func aalFor(amr AMR) string {
+	if len(amr) >= 2 {
+		return AAL2
+	}
+	return AAL1
+}
+
+// newRefreshToken genera un refresh token aleatorio para la sesión y guarda su hash
+func (s *TokenService) newRefreshToken(tx *gorm.DB, sessionID uuid.UUID) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	stored := models.RefreshToken{
+		IDRefreshToken: uuid.New(),
+		IDSesion:       sessionID,
+		TokenHash:      hashToken(token),
+	}
+	if err := tx.Create(&stored).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// randomToken genera 32 bytes aleatorios codificados en base64 URL-safe
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken SHA-256 del token; suficiente para secretos aleatorios de 256 bits
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"goServices/pkg/models"
+	"goServices/pkg/notify"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errores de verificación de contacto
+var (
+	ErrInvalidVerification   = errors.New("invalid or expired verification code")
+	ErrVerificationThrottled = errors.New("verification sent too recently")
+	ErrAlreadyVerified       = errors.New("already verified")
+	ErrNoPhone               = errors.New("no phone number on profile")
+)
+
+// VerificationConfig configuración de la verificación de email y teléfono
+type VerificationConfig struct {
+	Sender notify.Sender
+	// VerifyEmailURL página del frontend que recibe ?token= y llama a /auth/verify-email
+	VerifyEmailURL string
+	// EmailTTL vida del enlace de verificación (24h por defecto)
+	EmailTTL time.Duration
+	// SMSTTL vida del código SMS (10m por defecto)
+	SMSTTL time.Duration
+	// MaxAttempts intentos fallidos antes de invalidar el código SMS (5 por defecto)
+	MaxAttempts int
+	// ResendInterval espera mínima entre dos envíos (60s por defecto)
+	ResendInterval time.Duration
+	// MaxSendsPerHour envíos por usuario y tipo en una hora (5 por defecto)
+	MaxSendsPerHour int
+}
+
+// VerificationService confirma el email y el teléfono de los usuarios
+type VerificationService struct {
+	db  *gorm.DB
+	cfg VerificationConfig
+}
+
+// NewVerificationService crea el servicio de verificación
+func NewVerificationService(db *gorm.DB, cfg VerificationConfig) *VerificationService {
+	if cfg.EmailTTL == 0 {
+		cfg.EmailTTL = 24 * time.Hour
+	}
+	if cfg.SMSTTL == 0 {
+		cfg.SMSTTL = 10 * time.Minute
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.ResendInterval == 0 {
+		cfg.ResendInterval = time.Minute
+	}
+	if cfg.MaxSendsPerHour == 0 {
+		cfg.MaxSendsPerHour = 5
+	}
+	return &VerificationService{db: db, cfg: cfg}
+}
+
+// SendEmail envía un enlace para confirmar el email del usuario
+func (s *VerificationService) SendEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		return err
+	}
+	if user.EmailVerificadoAt != nil {
+		return ErrAlreadyVerified
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.issue(uuid.New(), userID, models.VerificacionEmail, email, hashToken(token), s.cfg.EmailTTL); err != nil {
+		return err
+	}
+
+	link := s.cfg.VerifyEmailURL + "?" + url.Values{"token": {token}}.Encode()
+	return s.cfg.Sender.Send(ctx, notify.Message{
+		Channel: notify.ChannelEmail,
+		To:      email,
+		Subject: "Confirma tu email",
+		Body:    fmt.Sprintf("Confirma tu email con este enlace (vence en %d horas):\n%s", int(s.cfg.EmailTTL.Hours()), link),
+	})
+}
+
+// VerifyEmail canjea el token del enlace y marca el email como verificado
+func (s *VerificationService) VerifyEmail(token string) (uuid.UUID, error) {
+	var userID uuid.UUID
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var vt models.TokenVerificacion
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND tipo = ? AND used_at IS NULL AND expires_at > ?",
+				hashToken(strings.TrimSpace(token)), models.VerificacionEmail, time.Now()).
+			First(&vt).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrInvalidVerification
+			}
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&vt).Update("used_at", &now).Error; err != nil {
+			return err
+		}
+		userID = vt.IDUsuario
+		return tx.Model(&models.User{}).Where("id = ?", vt.IDUsuario).Update("email_verificado_at", &now).Error
+	})
+
+	return userID, err
+}
+
+// SendPhone envía un código SMS al teléfono del perfil de cliente
+func (s *VerificationService) SendPhone(ctx context.Context, userID uuid.UUID) error {
+	var perfil models.PerfilCliente
+	if err := s.db.First(&perfil, "id_usuario = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrNoPhone
+		}
+		return err
+	}
+	phone := NormalizePhone(perfil.Telefono)
+	if phone == "" {
+		return ErrNoPhone
+	}
+	if perfil.TelefonoVerificadoAt != nil {
+		return ErrAlreadyVerified
+	}
+	if err := ensurePhoneAvailable(s.db, userID, phone); err != nil {
+		return err
+	}
+
+	code, err := randomDigits(totpDigits)
+	if err != nil {
+		return err
+	}
+
+	// El hash se sala con el id del token, que se genera antes de guardarlo
+	id := uuid.New()
+	if err := s.issue(id, userID, models.VerificacionTelefono, phone, hashOTP(id, code), s.cfg.SMSTTL); err != nil {
+		return err
+	}
+
+	return s.cfg.Sender.Send(ctx, notify.Message{
+		Channel: notify.ChannelSMS,
+		To:      phone,
+		Body:    fmt.Sprintf("Tu código de verificación es %s. Vence en %d minutos.", code, int(s.cfg.SMSTTL.Minutes())),
+	})
+}
+
+// VerifyPhone valida el código SMS y marca el teléfono como verificado. Cada fallo
+// suma un intento; si el teléfono del perfil cambió el código deja de servir.
+func (s *VerificationService) VerifyPhone(userID uuid.UUID, code string) error {
+	valid := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var vt models.TokenVerificacion
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id_usuario = ? AND tipo = ? AND used_at IS NULL AND expires_at > ?",
+				userID, models.VerificacionTelefono, time.Now()).
+			Order("created_at DESC").
+			First(&vt).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+		if vt.Intentos >= s.cfg.MaxAttempts {
+			return nil
+		}
+
+		if !hmac.Equal([]byte(hashOTP(vt.IDToken, strings.TrimSpace(code))), []byte(vt.TokenHash)) {
+			return tx.Model(&vt).Update("intentos", gorm.Expr("intentos + 1")).Error
+		}
+
+		now := time.Now()
+		if err := tx.Model(&vt).Update("used_at", &now).Error; err != nil {
+			return err
+		}
+		ok, err := markPhoneVerified(tx, userID, vt.Destino, now)
+		valid = ok
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrInvalidVerification
+	}
+	return nil
+}
+
+// Status devuelve el estado de verificación del usuario; sin fila en users
+// (p. ej. un token de Supabase) no hay nada verificado
+func (s *VerificationService) Status(userID uuid.UUID) (*models.VerificationStatusResponse, error) {
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &models.VerificationStatusResponse{}, nil
+		}
+		return nil, err
+	}
+
+	status := &models.VerificationStatusResponse{EmailVerificadoAt: user.EmailVerificadoAt}
+
+	var perfil models.PerfilCliente
+	err := s.db.First(&perfil, "id_usuario = ?", userID).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	if err == nil {
+		status.Telefono = perfil.Telefono
+		status.TelefonoVerificadoAt = perfil.TelefonoVerificadoAt
+	}
+
+	return status, nil
+}
+
+// Cleanup borra los tokens vencidos hace más de una hora; los recientes se
+// conservan para el límite de envíos por hora
+func (s *VerificationService) Cleanup() error {
+	return s.db.Where("expires_at < ?", time.Now().Add(-time.Hour)).Delete(&models.TokenVerificacion{}).Error
+}
+
+// issue guarda un token nuevo aplicando el límite de reenvíos e invalida los
+// anteriores del mismo tipo
+func (s *VerificationService) issue(id, userID uuid.UUID, tipo, destino, hash string, ttl time.Duration) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var last models.TokenVerificacion
+		err := tx.Where("id_usuario = ? AND tipo = ?", userID, tipo).Order("created_at DESC").First(&last).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if err == nil && now.Sub(last.CreatedAt) < s.cfg.ResendInterval {
+			return ErrVerificationThrottled
+		}
+
+		var sent int64
+		if err := tx.Model(&models.TokenVerificacion{}).
+			Where("id_usuario = ? AND tipo = ? AND created_at > ?", userID, tipo, now.Add(-time.Hour)).
+			Count(&sent).Error; err != nil {
+			return err
+		}
+		if int(sent) >= s.cfg.MaxSendsPerHour {
+			return ErrVerificationThrottled
+		}
+
+		// Los tokens anteriores se marcan usados en vez de borrarse para contar los envíos
+		if err := tx.Model(&models.TokenVerificacion{}).
+			Where("id_usuario = ? AND tipo = ? AND used_at IS NULL", userID, tipo).
+			Update("used_at", &now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.TokenVerificacion{
+			IDToken:   id,
+			IDUsuario: userID,
+			Tipo:      tipo,
+			Destino:   destino,
+			TokenHash: hash,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+}
+
+// markPhoneVerified marca el teléfono del perfil si coincide con el verificado y
+// lo guarda normalizado, como lo busca el login por SMS
+func markPhoneVerified(tx *gorm.DB, userID uuid.UUID, phone string, at time.Time) (bool, error) {
+	var perfil models.PerfilCliente
+	if err := tx.First(&perfil, "id_usuario = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if NormalizePhone(perfil.Telefono) != phone {
+		return false, nil
+	}
+	if err := ensurePhoneAvailable(tx, userID, phone); err != nil {
+		return false, err
+	}
+
+	err := tx.Model(&models.PerfilCliente{}).
+		Where("id_perfil = ?", perfil.IDPerfil).
+		Updates(map[string]interface{}{"telefono": phone, "telefono_verificado_at": &at}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return false, ErrTelefonoTaken
+	}
+	return err == nil, err
+}
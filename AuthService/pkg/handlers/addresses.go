@@ -1,28 +1,29 @@
 package handlers
 
 import (
+	"errors"
+	"goServices/pkg/auth"
 	"goServices/pkg/middleware"
 	"goServices/pkg/models"
+	"goServices/pkg/policy"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // GetMyAddresses obtiene las direcciones del usuario autenticado
-func GetMyAddresses(db *gorm.DB) fiber.Handler {
+func GetMyAddresses(db *gorm.DB, profiles *auth.ProfileService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID, err := middleware.GetUserIDFromContext(c)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 		}
 
-		var perfil models.PerfilCliente
-		if err := db.First(&perfil, "id_usuario = ?", userID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Client profile not found"})
-			}
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		perfil, err := profiles.Get(userID)
+		if err != nil {
+			return profileError(c, err)
 		}
 
 		var direcciones []models.Direccion
@@ -35,7 +36,7 @@ func GetMyAddresses(db *gorm.DB) fiber.Handler {
 }
 
 // CreateAddress crea una nueva dirección para el usuario autenticado
-func CreateAddress(db *gorm.DB) fiber.Handler {
+func CreateAddress(db *gorm.DB, profiles *auth.ProfileService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID, err := middleware.GetUserIDFromContext(c)
 		if err != nil {
@@ -48,12 +49,9 @@ func CreateAddress(db *gorm.DB) fiber.Handler {
 		}
 
 		// Obtener el perfil del cliente
-		var perfil models.PerfilCliente
-		if err := db.First(&perfil, "id_usuario = ?", userID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Client profile not found"})
-			}
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		perfil, err := profiles.Get(userID)
+		if err != nil {
+			return profileError(c, err)
 		}
 
 		// Si esta es la primera dirección, marcarla como predeterminada
@@ -91,7 +89,7 @@ func CreateAddress(db *gorm.DB) fiber.Handler {
 // UpdateAddress actualiza una dirección del usuario autenticado
 func UpdateAddress(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userID, err := middleware.GetUserIDFromContext(c)
+		principal, err := middleware.GetPrincipalFromContext(c)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 		}
@@ -107,27 +105,18 @@ func UpdateAddress(db *gorm.DB) fiber.Handler {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 		}
 
-		// Verificar que la dirección pertenece al usuario
-		var direccion models.Direccion
-		if err := db.First(&direccion, "id_direccion = ?", addressID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Address not found"})
-			}
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
-		}
-
-		// Verificar que el perfil pertenece al usuario
-		var perfil models.PerfilCliente
-		if err := db.First(&perfil, "id_perfil = ?", direccion.IDPerfil).Error; err != nil || perfil.IDUsuario != userID {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+		// Cargar la dirección; una ajena se trata igual que una inexistente
+		direccion, err := findAddress(db, principal, policy.ActionEdit, addressID)
+		if err != nil {
+			return addressError(c, err)
 		}
 
 		// Si se marca como predeterminada, desmarcar las otras
 		if req.EsPredeterminada {
-			db.Model(&models.Direccion{}).Where("id_perfil = ? AND id_direccion != ?", perfil.IDPerfil, addressID).Update("es_predeterminada", false)
+			db.Model(&models.Direccion{}).Where("id_perfil = ? AND id_direccion != ?", direccion.IDPerfil, addressID).Update("es_predeterminada", false)
 		}
 
-		if err := db.Model(&direccion).Updates(req).Error; err != nil {
+		if err := db.Omit(clause.Associations).Model(direccion).Updates(req).Error; err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update address"})
 		}
 
@@ -138,7 +127,7 @@ func UpdateAddress(db *gorm.DB) fiber.Handler {
 // DeleteAddress elimina una dirección del usuario autenticado
 func DeleteAddress(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userID, err := middleware.GetUserIDFromContext(c)
+		principal, err := middleware.GetPrincipalFromContext(c)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 		}
@@ -149,25 +138,41 @@ func DeleteAddress(db *gorm.DB) fiber.Handler {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid address ID"})
 		}
 
-		// Verificar que la dirección pertenece al usuario
-		var direccion models.Direccion
-		if err := db.First(&direccion, "id_direccion = ?", addressID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Address not found"})
-			}
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
-		}
-
-		// Verificar que el perfil pertenece al usuario
-		var perfil models.PerfilCliente
-		if err := db.First(&perfil, "id_perfil = ?", direccion.IDPerfil).Error; err != nil || perfil.IDUsuario != userID {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+		// Cargar la dirección; una ajena se trata igual que una inexistente
+		direccion, err := findAddress(db, principal, policy.ActionDelete, addressID)
+		if err != nil {
+			return addressError(c, err)
 		}
 
-		if err := db.Delete(&direccion).Error; err != nil {
+		if err := db.Delete(direccion).Error; err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete address"})
 		}
 
 		return c.SendStatus(fiber.StatusNoContent)
 	}
 }
+
+// findAddress carga la dirección con su perfil y aplica la política de propiedad
+func findAddress(db *gorm.DB, principal *auth.Principal, action policy.Action, addressID string) (*models.Direccion, error) {
+	var direccion models.Direccion
+	if err := db.Preload("PerfilCliente").First(&direccion, "id_direccion = ?", addressID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, policy.ErrNotFound
+		}
+		return nil, err
+	}
+
+	if err := policy.Authorize(principal, action, direccion); err != nil {
+		return nil, err
+	}
+
+	return &direccion, nil
+}
+
+// addressError traduce los errores de findAddress a respuestas HTTP
+func addressError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, policy.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Address not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+}
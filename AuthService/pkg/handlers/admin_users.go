@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetAdminUsers lista usuarios con búsqueda en nombre y apellido, filtros por
+// rol, estado y fecha de alta, orden y paginación
+func GetAdminUsers(accounts *auth.AccountService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := auth.UserFilter{
+			Query:    c.Query("q"),
+			Rol:      c.Query("rol"),
+			Sort:     c.Query("sort"),
+			Page:     c.QueryInt("page", 1),
+			PageSize: c.QueryInt("page_size", 20),
+		}
+		if filter.Page < 1 {
+			filter.Page = 1
+		}
+		if filter.PageSize < 1 || filter.PageSize > 100 {
+			filter.PageSize = 20
+		}
+
+		switch c.Query("estado") {
+		case "":
+		case "activo":
+			disabled := false
+			filter.Disabled = &disabled
+		case "desactivado":
+			disabled := true
+			filter.Disabled = &disabled
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "estado must be activo or desactivado"})
+		}
+
+		var err error
+		if filter.CreatedAfter, err = parseDateParam(c.Query("created_from"), false); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid created_from"})
+		}
+		if filter.CreatedBefore, err = parseDateParam(c.Query("created_to"), true); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid created_to"})
+		}
+
+		users, total, err := accounts.List(filter)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidUserFilter) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid search or sort"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch users"})
+		}
+
+		return c.JSON(models.AdminUserListResponse{
+			Data:       users,
+			Total:      total,
+			Page:       filter.Page,
+			PageSize:   filter.PageSize,
+			TotalPages: (int(total) + filter.PageSize - 1) / filter.PageSize,
+		})
+	}
+}
+
+// parseDateParam acepta RFC 3339 o una fecha (2006-01-02); como límite
+// superior, una fecha incluye el día completo
+func parseDateParam(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// ChangeUserRole cambia el rol (users.rol) de un usuario
+func ChangeUserRole(accounts *auth.AccountService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		var req models.ChangeUserRoleRequest
+		if err := c.BodyParser(&req); err != nil || req.Rol == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		user, err := accounts.SetRole(principal, userID, req.Rol)
+		if err != nil {
+			return accountError(c, err)
+		}
+
+		return c.JSON(user)
+	}
+}
+
+// DeactivateUser desactiva la cuenta de un usuario y cierra sus sesiones
+func DeactivateUser(accounts *auth.AccountService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		user, err := accounts.Deactivate(principal, userID)
+		if err != nil {
+			return accountError(c, err)
+		}
+
+		return c.JSON(user)
+	}
+}
+
+// ReactivateUser vuelve a activar la cuenta de un usuario
+func ReactivateUser(accounts *auth.AccountService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		user, err := accounts.Reactivate(principal, userID)
+		if err != nil {
+			return accountError(c, err)
+		}
+
+		return c.JSON(user)
+	}
+}
+
+// ForceLogoutUser cierra todas las sesiones del usuario y revoca sus access tokens
+func ForceLogoutUser(accounts *auth.AccountService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		revoked, err := accounts.ForceLogout(principal, userID)
+		if err != nil {
+			return accountError(c, err)
+		}
+
+		return c.JSON(fiber.Map{"revoked": revoked})
+	}
+}
+
+// accountError traduce los errores de gestión de cuentas a respuestas HTTP
+func accountError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrAccountNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	case errors.Is(err, auth.ErrInvalidUserRole):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, auth.ErrOwnAccountChange):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Admins cannot change their own role or status",
+			"code":  "own_account",
+		})
+	case errors.Is(err, auth.ErrAdminAccountOnly):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only admins can grant the admin role or change admin accounts",
+			"code":  "admin_only",
+		})
+	case errors.Is(err, auth.ErrPrivilegedAccount):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "User holds permissions you do not have",
+			"code":  "privileged_account",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user"})
+}
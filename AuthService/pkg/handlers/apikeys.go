@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetAPIKeys lista las claves API emitidas (solo admins)
+func GetAPIKeys(keys *auth.APIKeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		list, err := keys.List()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		return c.JSON(list)
+	}
+}
+
+// CreateAPIKey emite una clave API y devuelve su valor completo una sola vez
+func CreateAPIKey(keys *auth.APIKeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.CreateAPIKeyRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		key, raw, err := keys.Create(principal.UserID, req)
+		if err != nil {
+			if errors.Is(err, auth.ErrAPIKeyScopeNeeded) || errors.Is(err, auth.ErrAPIKeyPastExpiry) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create API key"})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(models.APIKeySecretResponse{
+			Clave:  key,
+			APIKey: raw,
+		})
+	}
+}
+
+// RevokeAPIKey revoca una clave API
+func RevokeAPIKey(keys *auth.APIKeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keyID, err := uuid.Parse(c.Params("id_clave"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid API key ID"})
+		}
+
+		if err := keys.Revoke(keyID); err != nil {
+			if errors.Is(err, auth.ErrAPIKeyNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke API key"})
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
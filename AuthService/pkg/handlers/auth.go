@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/models"
+	"log"
+	"net/mail"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// minPasswordLength longitud mínima de contraseña
+const minPasswordLength = 8
+
+// dummyPasswordHash se verifica cuando el email no existe, para que el tiempo de
+// respuesta no revele qué cuentas están registradas
+var dummyPasswordHash, _ = auth.HashPassword("dummy-password-for-timing")
+
+// Signup registra un usuario con email y contraseña
+func Signup(db *gorm.DB, tokens *auth.TokenService, verification *auth.VerificationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.SignupRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		email, err := normalizeEmail(req.Email)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid email"})
+		}
+		if len(req.Password) < minPasswordLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password must be at least 8 characters"})
+		}
+		if strings.TrimSpace(req.Nombre) == "" || strings.TrimSpace(req.Apellido) == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nombre and apellido are required"})
+		}
+
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hash password"})
+		}
+
+		user := models.User{
+			ID:       uuid.New(),
+			Nombre:   strings.TrimSpace(req.Nombre),
+			Apellido: strings.TrimSpace(req.Apellido),
+			Rol:      string(models.RolCliente),
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			if err := tx.Model(&models.CuentaLocal{}).Where("email = ?", email).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return errEmailTaken
+			}
+
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.CuentaLocal{
+				IDUsuario:    user.ID,
+				Email:        email,
+				PasswordHash: hash,
+			}).Error
+		})
+		if err != nil {
+			if errors.Is(err, errEmailTaken) || errors.Is(err, gorm.ErrDuplicatedKey) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Email already registered"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user"})
+		}
+
+		// El enlace de verificación no bloquea el registro si falla el envío
+		if err := verification.SendEmail(c.UserContext(), user.ID, email); err != nil {
+			log.Printf("Warning: failed to send verification email to %s: %v", email, err)
+		}
+
+		resp, err := tokens.IssuePair(&user, email, deviceInfo(c, req.Dispositivo), []string{auth.AMRPassword})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to issue tokens"})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(resp)
+	}
+}
+
+// Login autentica con email y contraseña y emite un par de tokens. Si el usuario
+// tiene 2FA habilitado responde un mfa_token para completar el login en /auth/2fa/verify.
+func Login(db *gorm.DB, tokens *auth.TokenService, mfa *auth.MFAService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.LoginRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		email, _ := normalizeEmail(req.Email)
+
+		var cuenta models.CuentaLocal
+		if err := db.First(&cuenta, "email = ?", email).Error; err != nil {
+			if err != gorm.ErrRecordNotFound {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+			}
+			auth.VerifyPassword(req.Password, dummyPasswordHash)
+			return invalidCredentials(c)
+		}
+
+		ok, err := auth.VerifyPassword(req.Password, cuenta.PasswordHash)
+		if err != nil || !ok {
+			return invalidCredentials(c)
+		}
+
+		var user models.User
+		if err := db.First(&user, "id = ?", cuenta.IDUsuario).Error; err != nil {
+			return invalidCredentials(c)
+		}
+
+		// Segundo paso si el usuario tiene 2FA
+		enabled, err := mfa.Enabled(user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		if enabled {
+			challenge, expiresIn, err := tokens.IssueMFAChallenge(user.ID, []string{auth.AMRPassword})
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to issue tokens"})
+			}
+			return c.JSON(models.MFAChallengeResponse{
+				MFARequired: true,
+				MFAToken:    challenge,
+				ExpiresIn:   expiresIn,
+			})
+		}
+
+		resp, err := tokens.IssuePair(&user, cuenta.Email, deviceInfo(c, req.Dispositivo), []string{auth.AMRPassword})
+		if err != nil {
+			return issueError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// Refresh canjea un refresh token por un par nuevo
+func Refresh(tokens *auth.TokenService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.RefreshRequest
+		if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		resp, err := tokens.Refresh(req.RefreshToken, deviceInfo(c, ""))
+		if err != nil {
+			if errors.Is(err, auth.ErrRefreshTokenReused) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Refresh token already used, session revoked",
+					"code":  "refresh_token_reused",
+				})
+			}
+			if errors.Is(err, auth.ErrAccountDisabled) {
+				return accountDisabled(c)
+			}
+			if errors.Is(err, auth.ErrInvalidRefreshToken) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid refresh token",
+					"code":  "invalid_refresh_token",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refresh tokens"})
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// Logout revoca la sesión del refresh token recibido
+func Logout(tokens *auth.TokenService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.RefreshRequest
+		if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		if err := tokens.Revoke(req.RefreshToken); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke token"})
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// errEmailTaken el email ya tiene una cuenta local
+var errEmailTaken = errors.New("email already registered")
+
+// normalizeEmail valida el email y lo normaliza a minúsculas
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("invalid email")
+	}
+	return email, nil
+}
+
+// deviceInfo datos del dispositivo que hace la petición
+func deviceInfo(c *fiber.Ctx, dispositivo string) models.DeviceInfo {
+	return models.DeviceInfo{
+		Dispositivo: dispositivo,
+		UserAgent:   c.Get(fiber.HeaderUserAgent),
+		IP:          c.IP(),
+		DeviceID:    c.Get("X-Device-ID"),
+	}
+}
+
+// issueError respuesta cuando no se pudo emitir el par de tokens
+func issueError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, auth.ErrAccountDisabled) {
+		return accountDisabled(c)
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to issue tokens"})
+}
+
+// accountDisabled respuesta para cuentas desactivadas por un admin
+func accountDisabled(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "Account disabled",
+		"code":  "account_disabled",
+	})
+}
+
+// invalidCredentials respuesta única para email o contraseña incorrectos
+func invalidCredentials(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": "Invalid email or password",
+		"code":  "invalid_credentials",
+	})
+}
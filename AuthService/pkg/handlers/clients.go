@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetServiceClients lista los clientes de servicio (solo admins)
+func GetServiceClients(clients *auth.ClientService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		list, err := clients.List()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		return c.JSON(list)
+	}
+}
+
+// CreateServiceClient registra un cliente de servicio y devuelve su secreto una sola vez
+func CreateServiceClient(clients *auth.ClientService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.CreateServiceClientRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		client, secret, err := clients.Create(req)
+		if err != nil {
+			return serviceClientError(c, err)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(models.ServiceClientSecretResponse{
+			Client:       client,
+			ClientSecret: secret,
+		})
+	}
+}
+
+// RotateServiceClientSecret genera un secreto nuevo para el cliente
+func RotateServiceClientSecret(clients *auth.ClientService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		client, secret, err := clients.RotateSecret(c.Params("client_id"))
+		if err != nil {
+			return serviceClientError(c, err)
+		}
+
+		return c.JSON(models.ServiceClientSecretResponse{
+			Client:       client,
+			ClientSecret: secret,
+		})
+	}
+}
+
+// DeactivateServiceClient desactiva el cliente; no puede obtener tokens nuevos
+func DeactivateServiceClient(clients *auth.ClientService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := clients.Deactivate(c.Params("client_id")); err != nil {
+			return serviceClientError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// serviceClientError traduce los errores de gestión de clientes a respuestas HTTP
+func serviceClientError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidClientID), errors.Is(err, auth.ErrClientScopesNeeded):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, auth.ErrClientExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Client ID already registered"})
+	case errors.Is(err, auth.ErrClientNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Service client not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GetFederationProviders lista los proveedores externos con los que se puede iniciar sesión
+func GetFederationProviders(federation *auth.FederationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(federation.Providers())
+	}
+}
+
+// BeginFederatedLogin devuelve la URL del proveedor a la que redirigir el navegador
+func BeginFederatedLogin(federation *auth.FederationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		resp, err := federation.Begin(c.Params("proveedor"), nil)
+		if err != nil {
+			return federationError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// FederatedLoginCallback canjea el code y el state que el proveedor devolvió a la
+// página de callback por el mismo par de tokens que el login con contraseña. Con
+// 2FA habilitado responde un mfa_token.
+func FederatedLoginCallback(db *gorm.DB, tokens *auth.TokenService, federation *auth.FederationService, mfa *auth.MFAService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.FederationCallbackRequest
+		if err := c.BodyParser(&req); err != nil || req.State == "" || req.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		user, identity, err := federation.Login(req.State, req.Code)
+		if err != nil {
+			return federationError(c, err)
+		}
+
+		amr := []string{auth.AMRFederated}
+
+		enabled, err := mfa.Enabled(user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		if enabled {
+			challenge, expiresIn, err := tokens.IssueMFAChallenge(user.ID, amr)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to issue tokens"})
+			}
+			return c.JSON(models.MFAChallengeResponse{
+				MFARequired: true,
+				MFAToken:    challenge,
+				ExpiresIn:   expiresIn,
+			})
+		}
+
+		// El email de la cuenta local tiene prioridad sobre el del proveedor
+		email := identity.Email
+		var cuenta models.CuentaLocal
+		if err := db.First(&cuenta, "id_usuario = ?", user.ID).Error; err == nil {
+			email = cuenta.Email
+		}
+
+		resp, err := tokens.IssuePair(user, email, deviceInfo(c, req.Dispositivo), amr)
+		if err != nil {
+			return issueError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// GetMyIdentities lista los proveedores vinculados al usuario autenticado
+func GetMyIdentities(federation *auth.FederationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		identities, err := federation.List(principal.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		return c.JSON(identities)
+	}
+}
+
+// LinkIdentity inicia la vinculación de un proveedor; devuelve la URL del proveedor
+func LinkIdentity(federation *auth.FederationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.LinkIdentityRequest
+		if err := c.BodyParser(&req); err != nil || req.Proveedor == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		userID := principal.UserID
+		resp, err := federation.Begin(req.Proveedor, &userID)
+		if err != nil {
+			return federationError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// LinkIdentityCallback completa la vinculación con el code y el state del proveedor
+func LinkIdentityCallback(federation *auth.FederationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.FederationCallbackRequest
+		if err := c.BodyParser(&req); err != nil || req.State == "" || req.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		identity, err := federation.Link(principal.UserID, req.State, req.Code)
+		if err != nil {
+			return federationError(c, err)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(identity)
+	}
+}
+
+// UnlinkIdentity desvincula un proveedor del usuario autenticado
+func UnlinkIdentity(federation *auth.FederationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		identityID, err := uuid.Parse(c.Params("id_identidad"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid identity ID"})
+		}
+
+		if err := federation.Unlink(principal.UserID, identityID); err != nil {
+			return federationError(c, err)
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// federationError traduce los errores de federación a respuestas HTTP
+func federationError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrUnknownProvider):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown identity provider"})
+	case errors.Is(err, auth.ErrInvalidFederationState):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired login state",
+			"code":  "invalid_state",
+		})
+	case errors.Is(err, auth.ErrFederationFailed):
+		log.Printf("Federated login rejected: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Identity provider login failed",
+			"code":  "federation_failed",
+		})
+	case errors.Is(err, auth.ErrIdentityNotLinked):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "An account with this email already exists, sign in and link the provider from your account",
+			"code":  "identity_not_linked",
+		})
+	case errors.Is(err, auth.ErrFederatedSignupDisabled):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "This identity provider cannot create new accounts",
+			"code":  "signup_disabled",
+		})
+	case errors.Is(err, auth.ErrIdentityTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Identity already linked to another user",
+			"code":  "identity_taken",
+		})
+	case errors.Is(err, auth.ErrProviderAlreadyLinked):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Provider already linked",
+			"code":  "provider_already_linked",
+		})
+	case errors.Is(err, auth.ErrIdentityNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Linked identity not found"})
+	case errors.Is(err, auth.ErrLastLoginMethod):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Cannot unlink the only login method",
+			"code":  "last_login_method",
+		})
+	case errors.Is(err, auth.ErrProviderUnavailable):
+		log.Printf("Identity provider unavailable: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Identity provider unavailable"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Federation error"})
+}
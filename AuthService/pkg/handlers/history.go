@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetMyLoginHistory historial de logins exitosos y fallidos del usuario autenticado
+func GetMyLoginHistory(history *auth.LoginHistoryService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		return loginHistory(c, history, principal.UserID)
+	}
+}
+
+// GetUserLoginHistory historial de logins de cualquier usuario (permiso users:read)
+func GetUserLoginHistory(history *auth.LoginHistoryService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		return loginHistory(c, history, userID)
+	}
+}
+
+// loginHistory responde una página del historial del usuario
+func loginHistory(c *fiber.Ctx, history *auth.LoginHistoryService, userID uuid.UUID) error {
+	page := c.QueryInt("page", 1)
+	pageSize := c.QueryInt("page_size", 20)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	entries, total, err := history.List(userID, page, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.JSON(models.LoginHistoryResponse{
+		Data:       entries,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (int(total) + pageSize - 1) / pageSize,
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ImpersonateUser emite un token de corta duración para actuar como el usuario
+// (solo admins); queda registrado en la auditoría
+func ImpersonateUser(impersonation *auth.ImpersonationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		var req models.ImpersonateRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		resp, err := impersonation.Start(principal, userID, req, deviceInfo(c, ""))
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrImpersonationReason), errors.Is(err, auth.ErrImpersonateSelf):
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, auth.ErrImpersonateAdmin), errors.Is(err, auth.ErrImpersonateStaff), errors.Is(err, auth.ErrImpersonationChain):
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": err.Error(),
+					"code":  "impersonation_forbidden",
+				})
+			case errors.Is(err, auth.ErrImpersonationNotFound):
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start impersonation"})
+		}
+
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.Status(fiber.StatusCreated).JSON(resp)
+	}
+}
+
+// GetImpersonationAudit lista la auditoría de suplantaciones con filtros por
+// admin (id_actor) y usuario (id_usuario)
+func GetImpersonationAudit(impersonation *auth.ImpersonationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := auth.ImpersonationFilter{
+			Page:     c.QueryInt("page", 1),
+			PageSize: c.QueryInt("page_size", 50),
+		}
+		if filter.Page < 1 {
+			filter.Page = 1
+		}
+		if filter.PageSize < 1 || filter.PageSize > 200 {
+			filter.PageSize = 50
+		}
+		if v := c.Query("id_actor"); v != "" {
+			actorID, err := uuid.Parse(v)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid actor ID"})
+			}
+			filter.ActorID = &actorID
+		}
+		if v := c.Query("id_usuario"); v != "" {
+			userID, err := uuid.Parse(v)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+			}
+			filter.UserID = &userID
+		}
+
+		entries, total, err := impersonation.List(filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		return c.JSON(models.ImpersonationAuditResponse{
+			Data:       entries,
+			Total:      total,
+			Page:       filter.Page,
+			PageSize:   filter.PageSize,
+			TotalPages: (int(total) + filter.PageSize - 1) / filter.PageSize,
+		})
+	}
+}
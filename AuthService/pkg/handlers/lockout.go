@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+	"goServices/pkg/notify"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// LoginAccount clave de cuenta del login con contraseña (email)
+func LoginAccount(c *fiber.Ctx) string {
+	var req models.LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return ""
+	}
+	return auth.AccountKey("email", req.Email)
+}
+
+// OTPAccount clave de cuenta de los endpoints OTP (email o teléfono)
+func OTPAccount(c *fiber.Ctx) string {
+	var req models.OTPRequest
+	if err := c.BodyParser(&req); err != nil {
+		return ""
+	}
+	destino, err := otpDestination(req.Canal, req.Email, req.Telefono)
+	if err != nil {
+		return ""
+	}
+	if req.Canal == notify.ChannelSMS {
+		return auth.AccountKey("phone", destino)
+	}
+	return auth.AccountKey("email", destino)
+}
+
+// MFAAccount clave de cuenta del segundo paso del login: el usuario del
+// mfa_token, solo si el token es válido
+func MFAAccount(tokens *auth.TokenService) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		var req models.MFAVerifyRequest
+		if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.MFAToken) == "" {
+			return ""
+		}
+		challenge, err := tokens.VerifyMFAChallenge(req.MFAToken)
+		if err != nil {
+			return ""
+		}
+		return auth.AccountKey("user", challenge.Sub)
+	}
+}
+
+// PrincipalAccount clave de cuenta de las rutas autenticadas que piden un
+// código (deshabilitar 2FA, regenerar códigos); comparte la clave con
+// /auth/2fa/verify, así que los fallos de ambas suman
+func PrincipalAccount(c *fiber.Ctx) string {
+	principal, err := middleware.GetPrincipalFromContext(c)
+	if err != nil {
+		return ""
+	}
+	return auth.AccountKey("user", principal.UserID.String())
+}
+
+// UnlockUser borra los fallos y el bloqueo de las cuentas del usuario (solo admins)
+func UnlockUser(lockout *auth.LockoutService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		if err := lockout.UnlockUser(userID); err != nil {
+			if errors.Is(err, auth.ErrLockoutUserNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlock user"})
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
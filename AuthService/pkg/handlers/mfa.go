@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// SetupTOTP genera un secreto TOTP pendiente y devuelve la URI otpauth y su QR
+func SetupTOTP(mfa *auth.MFAService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		account := principal.Email
+		if account == "" {
+			account = principal.UserID.String()
+		}
+
+		resp, err := mfa.Setup(principal.UserID, account)
+		if err != nil {
+			return mfaError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// EnableTOTP verifica el primer código, habilita 2FA y devuelve los códigos de recuperación
+func EnableTOTP(mfa *auth.MFAService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.TOTPCodeRequest
+		if err := c.BodyParser(&req); err != nil || req.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		codes, err := mfa.Enable(principal.UserID, req.Code)
+		if err != nil {
+			return mfaError(c, err)
+		}
+
+		return c.JSON(models.RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// DisableTOTP deshabilita 2FA con un código TOTP o de recuperación
+func DisableTOTP(mfa *auth.MFAService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.TOTPCodeRequest
+		if err := c.BodyParser(&req); err != nil || req.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		if err := mfa.Disable(principal.UserID, req.Code); err != nil {
+			return mfaError(c, err)
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// RegenerateRecoveryCodes reemplaza los códigos de recuperación del usuario
+func RegenerateRecoveryCodes(mfa *auth.MFAService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.TOTPCodeRequest
+		if err := c.BodyParser(&req); err != nil || req.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		codes, err := mfa.RegenerateRecoveryCodes(principal.UserID, req.Code)
+		if err != nil {
+			return mfaError(c, err)
+		}
+
+		return c.JSON(models.RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// VerifyLoginMFA completa un login con 2FA canjeando el mfa_token y el código por tokens
+func VerifyLoginMFA(db *gorm.DB, tokens *auth.TokenService, mfa *auth.MFAService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.MFAVerifyRequest
+		if err := c.BodyParser(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		challenge, err := tokens.VerifyMFAChallenge(req.MFAToken)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired MFA token",
+				"code":  "invalid_mfa_token",
+			})
+		}
+
+		var user models.User
+		if err := db.First(&user, "id = ?", challenge.Sub).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired MFA token",
+				"code":  "invalid_mfa_token",
+			})
+		}
+
+		method, err := mfa.Check(user.ID, req.Code)
+		if err != nil {
+			return mfaError(c, err)
+		}
+
+		var cuenta models.CuentaLocal
+		db.First(&cuenta, "id_usuario = ?", user.ID)
+
+		amr := append([]string{}, challenge.Amr...)
+		amr = append(amr, method)
+
+		resp, err := tokens.IssuePair(&user, cuenta.Email, deviceInfo(c, req.Dispositivo), amr)
+		if err != nil {
+			return issueError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// mfaError traduce los errores de 2FA a respuestas HTTP
+func mfaError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid two-factor code",
+			"code":  "invalid_mfa_code",
+		})
+	case errors.Is(err, auth.ErrMFANotEnrolled):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor authentication not set up",
+			"code":  "mfa_not_enrolled",
+		})
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication already enabled",
+			"code":  "mfa_already_enabled",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Two-factor authentication error"})
+}
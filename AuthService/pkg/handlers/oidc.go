@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetOpenIDConfiguration publica el documento de discovery OIDC
+func GetOpenIDConfiguration(oidc *auth.OIDCProvider) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+		return c.JSON(oidc.Discovery())
+	}
+}
+
+// GetJWKS publica las claves públicas de firma, incluidas las retiradas que aún
+// pueden verificar tokens vigentes
+func GetJWKS(oidc *auth.OIDCProvider) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.JSON(oidc.JWKS())
+	}
+}
+
+// Authorize inicia el flujo authorization code + PKCE y redirige a la página de login
+func Authorize(oidc *auth.OIDCProvider) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		params := auth.AuthorizeParams{
+			ResponseType:        c.Query("response_type"),
+			ClientID:            c.Query("client_id"),
+			RedirectURI:         c.Query("redirect_uri"),
+			Scope:               c.Query("scope"),
+			State:               c.Query("state"),
+			Nonce:               c.Query("nonce"),
+			CodeChallenge:       c.Query("code_challenge"),
+			CodeChallengeMethod: c.Query("code_challenge_method"),
+		}
+
+		req, err := oidc.Authorize(params)
+		if err != nil {
+			var oauthErr *auth.OAuthError
+			switch {
+			case errors.As(err, &oauthErr):
+				return c.Redirect(oidc.ErrorRedirect(params.RedirectURI, params.State, oauthErr), fiber.StatusFound)
+			case errors.Is(err, auth.ErrUnknownClient), errors.Is(err, auth.ErrInvalidRedirectURI):
+				// Sin cliente o redirect_uri válidos no se redirige (open redirect)
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":             auth.OAuthInvalidRequest,
+					"error_description": err.Error(),
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		return c.Redirect(oidc.LoginRedirect(req), fiber.StatusFound)
+	}
+}
+
+// GetAuthorizationRequest datos de la solicitud pendiente para la página de login
+func GetAuthorizationRequest(oidc *auth.OIDCProvider) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID, err := uuid.Parse(c.Params("id_solicitud"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request ID"})
+		}
+
+		req, err := oidc.PendingRequest(requestID)
+		if err != nil {
+			return authorizationError(c, err)
+		}
+
+		return c.JSON(models.AuthorizationRequestResponse{
+			IDSolicitud: req.IDSolicitud,
+			ClientID:    req.ClientID,
+			Scope:       req.Scope,
+			ExpiresAt:   req.ExpiresAt,
+		})
+	}
+}
+
+// ApproveAuthorization emite el código para el usuario autenticado y devuelve la
+// URL de vuelta al cliente
+func ApproveAuthorization(oidc *auth.OIDCProvider) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		requestID, err := uuid.Parse(c.Params("id_solicitud"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request ID"})
+		}
+
+		redirect, err := oidc.Approve(requestID, principal)
+		if err != nil {
+			return authorizationError(c, err)
+		}
+
+		return c.JSON(models.AuthorizationRedirectResponse{RedirectTo: redirect})
+	}
+}
+
+// DenyAuthorization rechaza la solicitud y devuelve la URL de vuelta con access_denied
+func DenyAuthorization(oidc *auth.OIDCProvider) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID, err := uuid.Parse(c.Params("id_solicitud"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request ID"})
+		}
+
+		redirect, err := oidc.Deny(requestID)
+		if err != nil {
+			return authorizationError(c, err)
+		}
+
+		return c.JSON(models.AuthorizationRedirectResponse{RedirectTo: redirect})
+	}
+}
+
+// Token endpoint OAuth 2.0: authorization_code, refresh_token, client_credentials
+// y token exchange (RFC 8693). Los errores siguen el formato de RFC 6749 §5.2.
+func Token(oidc *auth.OIDCProvider, exchange *auth.ExchangeService, clients *auth.ClientService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+
+		var req models.OAuthTokenRequest
+		if err := c.BodyParser(&req); err != nil {
+			return oauthErrorResponse(c, &auth.OAuthError{Code: auth.OAuthInvalidRequest, Description: "invalid request body"})
+		}
+
+		var resp interface{}
+		var err error
+		switch req.GrantType {
+		case auth.GrantTypeTokenExchange:
+			resp, err = exchange.Exchange(req)
+		case auth.GrantTypeClientCredentials:
+			clientID, secret, ok := clientCredentials(c, req)
+			if !ok {
+				return oauthErrorResponse(c, &auth.OAuthError{Code: auth.OAuthInvalidRequest, Description: "malformed Basic authorization"})
+			}
+			resp, err = clients.Issue(clientID, secret, req.Audience, req.Scope)
+		default:
+			resp, err = oidc.Exchange(req, deviceInfo(c, ""))
+		}
+		if err != nil {
+			var oauthErr *auth.OAuthError
+			if errors.As(err, &oauthErr) {
+				return oauthErrorResponse(c, oauthErr)
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":             "server_error",
+				"error_description": "failed to issue tokens",
+			})
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// UserInfo claims OIDC del usuario del access token
+func UserInfo(oidc *auth.OIDCProvider) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		info, err := oidc.UserInfo(principal)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		return c.JSON(info)
+	}
+}
+
+// clientCredentials credenciales del cliente por HTTP Basic (client_secret_basic)
+// o en el cuerpo (client_secret_post)
+func clientCredentials(c *fiber.Ctx, req models.OAuthTokenRequest) (string, string, bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Basic ") {
+		return req.ClientID, req.ClientSecret, true
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+	rawID, rawSecret, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", false
+	}
+	// RFC 6749 §2.3.1: id y secreto van form-urlencoded dentro de Basic
+	clientID, err := url.QueryUnescape(rawID)
+	if err != nil {
+		return "", "", false
+	}
+	secret, err := url.QueryUnescape(rawSecret)
+	if err != nil {
+		return "", "", false
+	}
+	return clientID, secret, true
+}
+
+// oauthErrorResponse responde un error OAuth; invalid_client lleva 401
+func oauthErrorResponse(c *fiber.Ctx, err *auth.OAuthError) error {
+	status := fiber.StatusBadRequest
+	if err.Code == auth.OAuthInvalidClient {
+		status = fiber.StatusUnauthorized
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="auth"`)
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":             err.Code,
+		"error_description": err.Description,
+	})
+}
+
+// authorizationError traduce los errores de solicitudes de autorización
+func authorizationError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, auth.ErrAuthorizationExpired) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Authorization request not found or expired",
+			"code":  "authorization_expired",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/models"
+	"goServices/pkg/notify"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// RequestOTP envía un enlace mágico por email o un código de 6 dígitos por SMS.
+// Responde lo mismo exista o no la cuenta.
+func RequestOTP(otp *auth.OTPService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.OTPRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		destino, err := otpDestination(req.Canal, req.Email, req.Telefono)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if err := otp.Request(c.UserContext(), req.Canal, destino); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send code"})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "If the account exists, a code was sent",
+		})
+	}
+}
+
+// VerifyOTP canjea el código o el token del enlace mágico por el mismo par de
+// tokens que el login con contraseña. Con 2FA habilitado responde un mfa_token.
+func VerifyOTP(db *gorm.DB, tokens *auth.TokenService, otp *auth.OTPService, mfa *auth.MFAService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.OTPVerifyRequest
+		if err := c.BodyParser(&req); err != nil || req.Codigo == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		destino, err := otpDestination(req.Canal, req.Email, req.Telefono)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		user, err := otp.Verify(req.Canal, destino, req.Codigo)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidOTP) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired code",
+					"code":  "invalid_otp",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		amr := []string{auth.AMRSMS}
+		if req.Canal == notify.ChannelEmail {
+			amr = []string{auth.AMRMagicLink}
+		}
+
+		enabled, err := mfa.Enabled(user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		if enabled {
+			challenge, expiresIn, err := tokens.IssueMFAChallenge(user.ID, amr)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to issue tokens"})
+			}
+			return c.JSON(models.MFAChallengeResponse{
+				MFARequired: true,
+				MFAToken:    challenge,
+				ExpiresIn:   expiresIn,
+			})
+		}
+
+		var cuenta models.CuentaLocal
+		db.First(&cuenta, "id_usuario = ?", user.ID)
+
+		resp, err := tokens.IssuePair(user, cuenta.Email, deviceInfo(c, req.Dispositivo), amr)
+		if err != nil {
+			return issueError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// otpDestination valida y normaliza el destino según el canal
+func otpDestination(canal, email, telefono string) (string, error) {
+	switch canal {
+	case notify.ChannelEmail:
+		destino, err := normalizeEmail(email)
+		if err != nil {
+			return "", errors.New("Invalid email")
+		}
+		return destino, nil
+	case notify.ChannelSMS:
+		destino := auth.NormalizePhone(telefono)
+		if len(destino) < 7 {
+			return "", errors.New("Invalid phone number")
+		}
+		return destino, nil
+	}
+	return "", errors.New("canal must be email or sms")
+}
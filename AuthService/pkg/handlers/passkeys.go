@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BeginPasskeyRegistration devuelve las opciones para navigator.credentials.create
+func BeginPasskeyRegistration(passkeys *auth.PasskeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		resp, err := passkeys.BeginRegistration(principal.UserID, principal.Email)
+		if err != nil {
+			return passkeyError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// FinishPasskeyRegistration valida la credencial creada por el navegador y la guarda.
+// El cuerpo es la PublicKeyCredential tal cual; ceremony_id y nombre van en la query.
+func FinishPasskeyRegistration(passkeys *auth.PasskeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		ceremonyID, err := uuid.Parse(c.Query("ceremony_id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ceremony ID"})
+		}
+
+		credential, err := passkeys.FinishRegistration(principal.UserID, principal.Email, ceremonyID, c.Body(), c.Query("nombre"))
+		if err != nil {
+			return passkeyError(c, err)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(credential)
+	}
+}
+
+// GetMyPasskeys lista las passkeys del usuario autenticado
+func GetMyPasskeys(passkeys *auth.PasskeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		credentials, err := passkeys.List(principal.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		return c.JSON(credentials)
+	}
+}
+
+// UpdateMyPasskey renombra una passkey del usuario autenticado
+func UpdateMyPasskey(passkeys *auth.PasskeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		credentialID, err := uuid.Parse(c.Params("id_credencial"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid passkey ID"})
+		}
+
+		var req models.UpdatePasskeyRequest
+		if err := c.BodyParser(&req); err != nil || req.Nombre == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		credential, err := passkeys.Rename(principal.UserID, credentialID, req.Nombre)
+		if err != nil {
+			return passkeyError(c, err)
+		}
+
+		return c.JSON(credential)
+	}
+}
+
+// DeleteMyPasskey elimina una passkey del usuario autenticado
+func DeleteMyPasskey(passkeys *auth.PasskeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		credentialID, err := uuid.Parse(c.Params("id_credencial"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid passkey ID"})
+		}
+
+		if err := passkeys.Delete(principal.UserID, credentialID); err != nil {
+			return passkeyError(c, err)
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// BeginPasskeyLogin devuelve las opciones para navigator.credentials.get
+func BeginPasskeyLogin(passkeys *auth.PasskeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		resp, err := passkeys.BeginLogin()
+		if err != nil {
+			return passkeyError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// FinishPasskeyLogin valida la assertion del navegador y emite el mismo par de
+// tokens que el login con contraseña. Una passkey sin verificación de usuario
+// vale solo como primer factor: si el usuario tiene 2FA se pide el código.
+func FinishPasskeyLogin(db *gorm.DB, tokens *auth.TokenService, passkeys *auth.PasskeyService, mfa *auth.MFAService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ceremonyID, err := uuid.Parse(c.Query("ceremony_id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ceremony ID"})
+		}
+
+		user, amr, err := passkeys.FinishLogin(ceremonyID, c.Body())
+		if err != nil {
+			return passkeyError(c, err)
+		}
+
+		if len(amr) < 2 {
+			enabled, err := mfa.Enabled(user.ID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+			}
+			if enabled {
+				challenge, expiresIn, err := tokens.IssueMFAChallenge(user.ID, amr)
+				if err != nil {
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to issue tokens"})
+				}
+				return c.JSON(models.MFAChallengeResponse{
+					MFARequired: true,
+					MFAToken:    challenge,
+					ExpiresIn:   expiresIn,
+				})
+			}
+		}
+
+		var cuenta models.CuentaLocal
+		db.First(&cuenta, "id_usuario = ?", user.ID)
+
+		resp, err := tokens.IssuePair(user, cuenta.Email, deviceInfo(c, c.Query("dispositivo")), amr)
+		if err != nil {
+			return issueError(c, err)
+		}
+
+		return c.JSON(resp)
+	}
+}
+
+// passkeyError traduce los errores de passkeys a respuestas HTTP
+func passkeyError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCeremony):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired passkey ceremony",
+			"code":  "invalid_ceremony",
+		})
+	case errors.Is(err, auth.ErrInvalidPasskey):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid passkey",
+			"code":  "invalid_passkey",
+		})
+	case errors.Is(err, auth.ErrPasskeyCloned):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Passkey disabled, possible cloned authenticator",
+			"code":  "passkey_cloned",
+		})
+	case errors.Is(err, auth.ErrPasskeyDuplicate):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Passkey already registered",
+			"code":  "passkey_already_registered",
+		})
+	case errors.Is(err, auth.ErrPasskeyNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Passkey not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Passkey error"})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ForgotPassword envía el enlace de restablecimiento; responde lo mismo exista o
+// no la cuenta
+func ForgotPassword(passwords *auth.PasswordService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.ForgotPasswordRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		email, err := normalizeEmail(req.Email)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid email"})
+		}
+
+		if err := passwords.RequestReset(c.UserContext(), email); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send reset email"})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "If the account exists, a reset link was sent",
+		})
+	}
+}
+
+// ResetPassword fija una contraseña nueva con el token del enlace y cierra todas
+// las sesiones del usuario
+func ResetPassword(passwords *auth.PasswordService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.ResetPasswordRequest
+		if err := c.BodyParser(&req); err != nil || req.Token == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		if len(req.Password) < minPasswordLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password must be at least 8 characters"})
+		}
+
+		if err := passwords.Reset(c.UserContext(), req.Token, req.Password); err != nil {
+			return passwordError(c, err)
+		}
+
+		return c.JSON(fiber.Map{"message": "Password updated"})
+	}
+}
+
+// ChangePassword cambia la contraseña del usuario autenticado y cierra sus otras sesiones
+func ChangePassword(passwords *auth.PasswordService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.ChangePasswordRequest
+		if err := c.BodyParser(&req); err != nil || req.CurrentPassword == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		if len(req.NewPassword) < minPasswordLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password must be at least 8 characters"})
+		}
+
+		current, _ := uuid.Parse(principal.SessionID)
+
+		if err := passwords.Change(c.UserContext(), principal.UserID, current, req.CurrentPassword, req.NewPassword); err != nil {
+			return passwordError(c, err)
+		}
+
+		return c.JSON(fiber.Map{"message": "Password updated"})
+	}
+}
+
+// passwordError traduce los errores de contraseña a respuestas HTTP
+func passwordError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidResetToken):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset token",
+			"code":  "invalid_reset_token",
+		})
+	case errors.Is(err, auth.ErrWrongPassword):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Current password is incorrect",
+			"code":  "invalid_credentials",
+		})
+	case errors.Is(err, auth.ErrNoLocalAccount):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Account has no local password",
+			"code":  "no_local_password",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update password"})
+}
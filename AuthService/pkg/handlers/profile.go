@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetMyProfile obtiene el perfil de cliente del usuario autenticado
+func GetMyProfile(profiles *auth.ProfileService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := middleware.GetUserIDFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		perfil, err := profiles.Get(userID)
+		if err != nil {
+			return profileError(c, err)
+		}
+
+		return c.JSON(perfil)
+	}
+}
+
+// CreateMyProfile crea el perfil de cliente; si ya existe aplica los mismos
+// cambios y responde 200, así que se puede reintentar sin riesgo
+func CreateMyProfile(profiles *auth.ProfileService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return saveProfile(c, profiles, true)
+	}
+}
+
+// UpdateMyProfile actualiza el documento o el teléfono del perfil de cliente
+func UpdateMyProfile(profiles *auth.ProfileService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return saveProfile(c, profiles, false)
+	}
+}
+
+// saveProfile comparte la lectura de la petición entre el alta y la actualización
+func saveProfile(c *fiber.Ctx, profiles *auth.ProfileService, create bool) error {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var req models.ProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	perfil, created, err := profiles.Save(userID, req, create)
+	if err != nil {
+		return profileError(c, err)
+	}
+
+	if created {
+		return c.Status(fiber.StatusCreated).JSON(perfil)
+	}
+	return c.JSON(perfil)
+}
+
+// profileError traduce los errores de perfiles a respuestas HTTP
+func profileError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrProfileNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Client profile not found",
+			"code":  "profile_not_found",
+		})
+	case errors.Is(err, auth.ErrInvalidTelefono), errors.Is(err, auth.ErrInvalidDocumento):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, auth.ErrDocumentoTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Documento de identidad already registered to another user",
+			"code":  "documento_taken",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+}
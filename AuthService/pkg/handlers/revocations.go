@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"goServices/pkg/auth"
+	"goServices/pkg/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RevokeTokens revoca un access token por jti o todos los tokens de un usuario
+// emitidos antes de una fecha (solo admins). maxTokenTTL es la retención por
+// defecto de un jti cuando no se indica expires_at.
+func RevokeTokens(store auth.RevocationStore, maxTokenTTL time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.RevokeTokensRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		if (req.JTI == "") == (req.IDUsuario == nil) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Provide either jti or id_usuario"})
+		}
+
+		if req.JTI != "" {
+			expiresAt := time.Now().Add(maxTokenTTL)
+			if req.ExpiresAt != nil {
+				expiresAt = *req.ExpiresAt
+			}
+			if err := store.RevokeToken(req.JTI, expiresAt); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke token"})
+			}
+			return c.Status(fiber.StatusCreated).JSON(fiber.Map{"jti": req.JTI, "expires_at": expiresAt})
+		}
+
+		before := time.Now()
+		if req.Before != nil {
+			before = *req.Before
+		}
+		if err := store.RevokeUserBefore(*req.IDUsuario, before); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke tokens"})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id_usuario": req.IDUsuario, "before": before})
+	}
+}
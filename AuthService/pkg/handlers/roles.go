@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetRoles lista los roles con sus permisos
+func GetRoles(perms *auth.PermissionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roles, err := perms.ListRoles()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		return c.JSON(roles)
+	}
+}
+
+// GetPermissionCatalog lista los permisos que se pueden conceder a un rol
+func GetPermissionCatalog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(auth.Permissions)
+	}
+}
+
+// CreateRole crea un rol personalizado
+func CreateRole(perms *auth.PermissionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.CreateRoleRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		rol, err := perms.CreateRole(principal, req)
+		if err != nil {
+			return roleError(c, err)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(rol)
+	}
+}
+
+// UpdateRole cambia la descripción o los permisos de un rol
+func UpdateRole(perms *auth.PermissionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.UpdateRoleRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		rol, err := perms.UpdateRole(principal, c.Params("rol"), req)
+		if err != nil {
+			return roleError(c, err)
+		}
+
+		return c.JSON(rol)
+	}
+}
+
+// DeleteRole borra un rol personalizado y sus asignaciones
+func DeleteRole(perms *auth.PermissionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		if err := perms.DeleteRole(principal, c.Params("rol")); err != nil {
+			return roleError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// GetUserRoles roles personalizados asignados a un usuario
+func GetUserRoles(perms *auth.PermissionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		roles, err := perms.UserRoles(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		return c.JSON(roles)
+	}
+}
+
+// AssignUserRole asigna un rol personalizado a un usuario
+func AssignUserRole(perms *auth.PermissionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		var req models.AssignRoleRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		if err := perms.AssignRole(principal, userID, req.Rol); err != nil {
+			return roleError(c, err)
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// UnassignUserRole quita un rol personalizado a un usuario
+func UnassignUserRole(perms *auth.PermissionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		if err := perms.UnassignRole(principal, userID, c.Params("rol")); err != nil {
+			return roleError(c, err)
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// GetMyPermissions roles y permisos efectivos del usuario autenticado
+func GetMyPermissions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		set, err := principal.Permissions()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve permissions"})
+		}
+
+		return c.JSON(models.PermissionsResponse{
+			Roles:    principal.Roles,
+			Permisos: set.List(),
+		})
+	}
+}
+
+// roleError traduce los errores de gestión de roles
+func roleError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidRoleName), errors.Is(err, auth.ErrUnknownPermission):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, auth.ErrSystemRole):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+			"code":  "system_role",
+		})
+	case errors.Is(err, auth.ErrOwnRoleChange):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+			"code":  "own_account",
+		})
+	case errors.Is(err, auth.ErrPermissionGrant):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+			"code":  "permission_not_held",
+		})
+	case errors.Is(err, auth.ErrRoleExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, auth.ErrRoleNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Role not found"})
+	case errors.Is(err, auth.ErrRoleNotAssigned):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Role not assigned to user"})
+	case errors.Is(err, auth.ErrRoleUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+	"goServices/pkg/policy"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GetMySessions lista las sesiones activas del usuario autenticado
+func GetMySessions(tokens *auth.TokenService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		return listSessions(c, tokens, principal.UserID, principal.SessionID)
+	}
+}
+
+// RevokeMySession revoca una sesión del usuario autenticado
+func RevokeMySession(tokens *auth.TokenService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		sessionID, err := uuid.Parse(c.Params("id_sesion"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+		}
+
+		// Una sesión ajena se trata igual que una inexistente
+		session, err := tokens.FindSession(sessionID)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		if !policy.CanDelete(principal, session) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+		}
+
+		if err := tokens.RevokeSession(session.IDSesion, models.RevocadaUsuario); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// RevokeMySessions revoca todas las sesiones del usuario autenticado salvo la actual
+func RevokeMySessions(tokens *auth.TokenService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		// Con tokens de Supabase no hay sesión local que conservar
+		current, _ := uuid.Parse(principal.SessionID)
+
+		revoked, err := tokens.RevokeUserSessions(principal.UserID, current, models.RevocadaUsuario)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+		}
+
+		return c.JSON(fiber.Map{"revoked": revoked})
+	}
+}
+
+// GetUserSessions lista las sesiones activas de un usuario que el actor puede
+// gestionar (sessions:manage)
+func GetUserSessions(tokens *auth.TokenService, accounts *auth.AccountService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+		if err := accounts.GuardAccount(principal, userID); err != nil {
+			return accountError(c, err)
+		}
+
+		return listSessions(c, tokens, userID, "")
+	}
+}
+
+// RevokeUserSession revoca una sesión de un usuario que el actor puede
+// gestionar (sessions:manage)
+func RevokeUserSession(tokens *auth.TokenService, accounts *auth.AccountService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+		if err := accounts.GuardAccount(principal, userID); err != nil {
+			return accountError(c, err)
+		}
+		sessionID, err := uuid.Parse(c.Params("id_sesion"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+		}
+
+		session, err := tokens.FindSession(sessionID)
+		if err != nil || session.IDUsuario != userID {
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+			}
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+		}
+
+		if err := tokens.RevokeSession(session.IDSesion, models.RevocadaAdmin); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// RevokeUserSessions revoca todas las sesiones de un usuario que el actor
+// puede gestionar (sessions:manage)
+func RevokeUserSessions(tokens *auth.TokenService, accounts *auth.AccountService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		userID, err := uuid.Parse(c.Params("id_usuario"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+		if err := accounts.GuardAccount(principal, userID); err != nil {
+			return accountError(c, err)
+		}
+
+		revoked, err := tokens.RevokeUserSessions(userID, uuid.Nil, models.RevocadaAdmin)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+		}
+
+		return c.JSON(fiber.Map{"revoked": revoked})
+	}
+}
+
+// listSessions responde las sesiones activas marcando la actual
+func listSessions(c *fiber.Ctx, tokens *auth.TokenService, userID uuid.UUID, currentSessionID string) error {
+	sessions, err := tokens.ListSessions(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, models.SessionResponse{
+			Session: s,
+			Actual:  s.IDSesion.String() == currentSessionID,
+		})
+	}
+
+	return c.JSON(response)
+}
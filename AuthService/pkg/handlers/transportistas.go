@@ -101,3 +101,31 @@ func GetTransportista(db *gorm.DB) fiber.Handler {
 		return c.JSON(transportista)
 	}
 }
+
+// VerifyTransportista aprueba a un transportista pendiente de verificación
+func VerifyTransportista(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		transportistaID, err := uuid.Parse(c.Params("id_transportista"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid transportista ID"})
+		}
+
+		var transportista models.Transportista
+		if err := db.First(&transportista, "id_transportista = ?", transportistaID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Transportista not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		if transportista.Estado != string(models.EstadoVerificacionPendiente) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Transportista is not pending verification"})
+		}
+
+		if err := db.Model(&transportista).Update("estado", models.EstadoActivo).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify transportista"})
+		}
+		transportista.Estado = string(models.EstadoActivo)
+
+		return c.JSON(transportista)
+	}
+}
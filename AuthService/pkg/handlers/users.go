@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"goServices/pkg/auth"
 	"goServices/pkg/middleware"
 	"goServices/pkg/models"
+	"goServices/pkg/policy"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -55,11 +57,13 @@ func UpdateMe(db *gorm.DB) fiber.Handler {
 	}
 }
 
-// GetUser obtiene info de un usuario específico (solo el propio usuario o admins)
+// GetUser obtiene info de un usuario específico (el propio usuario, admins o
+// servicios internos con el scope users:read)
 func GetUser(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userID, err := middleware.GetUserIDFromContext(c)
-		if err != nil {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		service, serviceErr := middleware.GetServiceFromContext(c)
+		if err != nil && serviceErr != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 		}
 
@@ -69,14 +73,6 @@ func GetUser(db *gorm.DB) fiber.Handler {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
 		}
 
-		// Solo el propio usuario o admins pueden acceder
-		if userID != targetUserID {
-			var currentUser models.User
-			if err := db.First(&currentUser, "id = ?", userID).Error; err != nil || currentUser.Rol != "admin" {
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
-			}
-		}
-
 		var user models.User
 		if err := db.First(&user, "id = ?", targetUserID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
@@ -85,6 +81,12 @@ func GetUser(db *gorm.DB) fiber.Handler {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
 		}
 
+		// Solo el propio usuario, admins o quien tenga users:read pueden acceder;
+		// un usuario ajeno se responde igual que uno inexistente
+		if service == nil && !policy.CanView(principal, user) && !principal.HasPermission(auth.PermUsersRead) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
 		return c.JSON(user)
 	}
 }
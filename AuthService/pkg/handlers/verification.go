@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"goServices/pkg/auth"
+	"goServices/pkg/middleware"
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetMyVerification devuelve si el email y el teléfono del usuario están verificados
+func GetMyVerification(db *gorm.DB, verification *auth.VerificationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		status, err := verification.Status(principal.UserID)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		status.Email = userEmail(db, principal)
+
+		return c.JSON(status)
+	}
+}
+
+// SendEmailVerification envía el enlace de verificación al email del usuario
+func SendEmailVerification(db *gorm.DB, verification *auth.VerificationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		email := userEmail(db, principal)
+		if email == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No email on account"})
+		}
+
+		if err := verification.SendEmail(c.UserContext(), principal.UserID, email); err != nil {
+			return verificationError(c, err)
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Verification email sent"})
+	}
+}
+
+// VerifyEmail confirma el email con el token del enlace; no requiere sesión
+func VerifyEmail(verification *auth.VerificationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.VerifyEmailRequest
+		if err := c.BodyParser(&req); err != nil || req.Token == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		if _, err := verification.VerifyEmail(req.Token); err != nil {
+			return verificationError(c, err)
+		}
+
+		return c.JSON(fiber.Map{"message": "Email verified"})
+	}
+}
+
+// SendPhoneVerification envía un código SMS al teléfono del perfil del usuario
+func SendPhoneVerification(verification *auth.VerificationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		if err := verification.SendPhone(c.UserContext(), principal.UserID); err != nil {
+			return verificationError(c, err)
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Verification code sent"})
+	}
+}
+
+// VerifyPhone confirma el teléfono con el código SMS
+func VerifyPhone(verification *auth.VerificationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := middleware.GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		var req models.VerifyPhoneRequest
+		if err := c.BodyParser(&req); err != nil || req.Codigo == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+
+		if err := verification.VerifyPhone(principal.UserID, req.Codigo); err != nil {
+			return verificationError(c, err)
+		}
+
+		return c.JSON(fiber.Map{"message": "Phone verified"})
+	}
+}
+
+// userEmail email de la cuenta local o, para usuarios de Supabase, el del token
+func userEmail(db *gorm.DB, principal *auth.Principal) string {
+	var cuenta models.CuentaLocal
+	if err := db.First(&cuenta, "id_usuario = ?", principal.UserID).Error; err == nil {
+		return cuenta.Email
+	}
+	return principal.Email
+}
+
+// verificationError traduce los errores de verificación a respuestas HTTP
+func verificationError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidVerification):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification code",
+			"code":  "invalid_verification",
+		})
+	case errors.Is(err, auth.ErrVerificationThrottled):
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Verification sent too recently, try again later",
+			"code":  "verification_throttled",
+		})
+	case errors.Is(err, auth.ErrAlreadyVerified):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Already verified",
+			"code":  "already_verified",
+		})
+	case errors.Is(err, auth.ErrNoPhone):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No phone number on profile",
+			"code":  "phone_missing",
+		})
+	case errors.Is(err, auth.ErrTelefonoTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Phone number already verified by another user",
+			"code":  "telefono_taken",
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Verification error"})
+}
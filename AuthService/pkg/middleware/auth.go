@@ -1,108 +1,300 @@
 package middleware
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"strconv"
 	"strings"
 
+	"goServices/pkg/auth"
+	"goServices/pkg/models"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
-// Claims estructura del JWT de Supabase
-type Claims struct {
-	Sub string `json:"sub"`
-	Aud string `json:"aud"`
-	Iat int64  `json:"iat"`
-	Exp int64  `json:"exp"`
+// AuthConfig dependencias del middleware de autenticación
+type AuthConfig struct {
+	// Verifier valida firma y claims del JWT
+	Verifier auth.TokenVerifier
+	// Roles resuelve los roles cuando el token no los incluye (opcional)
+	Roles auth.RoleResolver
+	// Accounts rechaza a los usuarios desactivados (opcional)
+	Accounts AccountChecker
+	// Sessions rechaza tokens de sesiones revocadas (opcional)
+	Sessions SessionValidator
+	// Revocations lista de tokens revocados por jti o por usuario (opcional)
+	Revocations auth.RevocationStore
+	// Services valida tokens de servicio (client credentials); con él el
+	// middleware acepta también llamadas de servicios internos (opcional)
+	Services auth.TokenVerifier
+	// APIKeys autentica el header X-API-Key cuando no hay bearer token (opcional)
+	APIKeys APIKeyAuthenticator
+	// Permissions resuelve los permisos de RequirePermission (opcional; sin él
+	// solo admin tiene permisos)
+	Permissions auth.PermissionResolver
+	// Impersonation audita las peticiones con token de suplantación (opcional)
+	Impersonation ImpersonationAuditor
+}
+
+// ImpersonationAuditor guarda cada petición hecha con un token de suplantación
+type ImpersonationAuditor interface {
+	Record(entry models.AuditoriaSuplantacion) error
+}
+
+// APIKeyAuthenticator valida una clave API y devuelve el principal con sus scopes
+type APIKeyAuthenticator interface {
+	Authenticate(key string) (*auth.ServicePrincipal, error)
+}
+
+// AccountChecker indica si la cuenta del usuario fue desactivada
+type AccountChecker = auth.AccountChecker
+
+// SessionValidator comprueba que la sesión del token siga activa
+type SessionValidator interface {
+	ValidateSession(claims *auth.Claims) error
 }
 
 // AuthMiddleware valida el JWT de Supabase
-func AuthMiddleware(c *fiber.Ctx) error {
-	// Obtener el token del header
-	authHeader := c.Get("Authorization")
-	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "No token provided",
-		})
-	}
+func AuthMiddleware(cfg AuthConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Obtener el token del header
+		authHeader := c.Get("Authorization")
+		if authHeader == "" && cfg.APIKeys != nil {
+			if key := c.Get("X-API-Key"); key != "" {
+				return apiKeyCaller(c, cfg.APIKeys, key)
+			}
+		}
+		if authHeader == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "No token provided",
+				"code":  "token_missing",
+			})
+		}
 
-	// Extraer el token del formato "Bearer <token>"
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid authorization header format",
-		})
-	}
+		// Extraer el token del formato "Bearer <token>"
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid authorization header format",
+				"code":  "invalid_authorization_header",
+			})
+		}
 
-	token := parts[1]
+		token := parts[1]
 
-	// Decodificar el JWT sin validar la firma (en producción, validar con la clave pública de Supabase)
-	// Para desarrollo, extraemos el sub (user_id) del payload
-	claims, err := parseTokenClaims(token)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid token",
-		})
+		// Validar firma, expiración, audiencia y emisor
+		claims, err := cfg.Verifier.Verify(token)
+		if err != nil {
+			// Un token que no es de usuario puede ser de un servicio interno
+			if cfg.Services != nil {
+				if serviceClaims, serviceErr := cfg.Services.Verify(token); serviceErr == nil && serviceClaims.ClientID != "" {
+					return serviceCaller(c, cfg, serviceClaims)
+				}
+			}
+			return tokenError(c, err)
+		}
+
+		// Rechazar tokens revocados antes de su expiración
+		if cfg.Revocations != nil {
+			revoked, err := cfg.Revocations.IsRevoked(claims)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check token revocation"})
+			}
+			if revoked {
+				return tokenError(c, auth.ErrTokenRevoked)
+			}
+		}
+
+		// Rechazar tokens de sesiones revocadas
+		if cfg.Sessions != nil {
+			if err := cfg.Sessions.ValidateSession(claims); err != nil {
+				return tokenError(c, err)
+			}
+		}
+
+		// Construir el principal (sub como UUID, roles, sesión)
+		principal, err := auth.NewPrincipal(claims)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid user ID in token",
+				"code":  "invalid_subject",
+			})
+		}
+
+		// Rechazar usuarios desactivados aunque su token siga vigente
+		if cfg.Accounts != nil {
+			disabled, err := cfg.Accounts.Disabled(principal.UserID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check account status"})
+			}
+			if disabled {
+				return tokenError(c, auth.ErrAccountDisabled)
+			}
+		}
+
+		// Si el token no trae roles de aplicación, resolverlos desde la base (cacheado)
+		if len(principal.Roles) == 0 && cfg.Roles != nil {
+			roles, err := cfg.Roles.Roles(principal.UserID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve roles"})
+			}
+			principal.Roles = roles
+		}
+
+		// Los permisos se resuelven al primer uso, una vez por petición
+		if cfg.Permissions != nil {
+			principal.UsePermissions(cfg.Permissions)
+		}
+
+		// Almacenar el principal y el user_id en el contexto
+		c.Locals("principal", principal)
+		c.Locals("user_id", principal.UserID)
+		c.Locals("claims", claims)
+
+		// Un admin suplantando al usuario: ambas identidades quedan en el contexto
+		if principal.IsImpersonated() {
+			c.Locals("actor", principal.Actor)
+			return impersonatedCall(c, cfg.Impersonation, principal)
+		}
+
+		return c.Next()
 	}
+}
 
-	// Convertir el sub a UUID
-	userID, err := uuid.Parse(claims.Sub)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid user ID in token",
-		})
+// impersonatedCall ejecuta una petición hecha con token de suplantación y la
+// registra en la auditoría. Sin permiso de escritura solo pasan GET, HEAD y OPTIONS.
+func impersonatedCall(c *fiber.Ctx, audit ImpersonationAuditor, principal *auth.Principal) error {
+	var err error
+	if !principal.ImpersonationWrite && !isSafeMethod(c.Method()) {
+		err = impersonationForbidden(c, "Impersonation is read-only", "impersonation_read_only")
+	} else {
+		err = c.Next()
 	}
 
-	// Almacenar el user_id en el contexto
-	c.Locals("user_id", userID)
-	c.Locals("token", token)
+	if audit != nil {
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		evento := models.EventoSuplantacionPeticion
+		if blocked, _ := c.Locals("impersonation_blocked").(bool); blocked {
+			evento = models.EventoSuplantacionBloqueada
+		}
+		sessionID, _ := uuid.Parse(principal.SessionID)
 
-	return c.Next()
+		if auditErr := audit.Record(models.AuditoriaSuplantacion{
+			IDActor:   principal.Actor.UserID,
+			IDUsuario: principal.UserID,
+			IDSesion:  sessionID,
+			Evento:    evento,
+			Metodo:    c.Method(),
+			Ruta:      c.OriginalURL(),
+			Estado:    status,
+			IP:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+		}); auditErr != nil {
+			log.Printf("Failed to record impersonated request: %v", auditErr)
+		}
+	}
+
+	return err
 }
 
-// parseTokenClaims decodifica el JWT (sin validar firma, solo para desarrollo)
-func parseTokenClaims(tokenString string) (*Claims, error) {
-	parts := strings.Split(tokenString, ".")
-	if len(parts) != 3 {
-		return nil, fmt.Errorf("invalid token format")
-	}
+// isSafeMethod métodos que no modifican recursos
+func isSafeMethod(method string) bool {
+	return method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+}
 
-	// Decodificar el payload (parte 2)
-	payload := parts[1]
-	
-	// Agregar padding si es necesario
-	switch len(payload) % 4 {
-	case 1:
-		payload += "==="
-	case 2:
-		payload += "=="
-	case 3:
-		payload += "="
+// serviceCaller completa la autenticación de un token de servicio. Guarda el
+// servicio en el contexto y no un principal: las rutas de usuario lo rechazan y
+// solo pasan las que lo permiten con AllowService.
+func serviceCaller(c *fiber.Ctx, cfg AuthConfig, claims *auth.Claims) error {
+	if cfg.Revocations != nil {
+		revoked, err := cfg.Revocations.IsRevoked(claims)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check token revocation"})
+		}
+		if revoked {
+			return tokenError(c, auth.ErrTokenRevoked)
+		}
 	}
 
-	decodedPayload := make([]byte, len(payload))
-	n, err := decodeBase64URL(payload, decodedPayload)
+	c.Locals("service", auth.NewServicePrincipal(claims))
+	c.Locals("claims", claims)
+
+	return c.Next()
+}
+
+// apiKeyCaller autentica una integración por X-API-Key. Como un token de
+// servicio, solo pasa las rutas con AllowService para alguno de sus scopes.
+func apiKeyCaller(c *fiber.Ctx, keys APIKeyAuthenticator, key string) error {
+	service, err := keys.Authenticate(key)
 	if err != nil {
-		return nil, err
+		var limited *auth.RateLimitError
+		switch {
+		case errors.As(err, &limited):
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+			c.Set("X-RateLimit-Limit", strconv.Itoa(limited.Limit))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "API key rate limit exceeded",
+				"code":  "rate_limited",
+			})
+		case errors.Is(err, auth.ErrAPIKeyExpired):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "API key expired",
+				"code":  "api_key_expired",
+			})
+		case errors.Is(err, auth.ErrInvalidAPIKey):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid API key",
+				"code":  "invalid_api_key",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check API key"})
 	}
 
-	var claims Claims
-	if err := json.Unmarshal(decodedPayload[:n], &claims); err != nil {
-		return nil, err
-	}
+	c.Locals("service", service)
 
-	return &claims, nil
+	return c.Next()
 }
 
-// decodeBase64URL decodifica base64 URL-safe
-func decodeBase64URL(s string, dst []byte) (int, error) {
-	// Reemplazar caracteres base64-URL
-	s = strings.ReplaceAll(s, "-", "+")
-	s = strings.ReplaceAll(s, "_", "/")
+// tokenError responde 401 con un código distinto por cada causa de rechazo
+func tokenError(c *fiber.Ctx, err error) error {
+	message, code := "Invalid token", "invalid_token"
 
-	// Aquí simplificado; en producción usa base64.RawURLEncoding.DecodedLen
-	return len(s), nil
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		message, code = "Token expired", "token_expired"
+	case errors.Is(err, auth.ErrTokenNotYetValid):
+		message, code = "Token not yet valid", "token_not_yet_valid"
+	case errors.Is(err, auth.ErrInvalidAudience):
+		message, code = "Invalid token audience", "invalid_audience"
+	case errors.Is(err, auth.ErrInvalidIssuer):
+		message, code = "Invalid token issuer", "invalid_issuer"
+	case errors.Is(err, auth.ErrInvalidSignature):
+		message, code = "Invalid token signature", "invalid_signature"
+	case errors.Is(err, auth.ErrUnknownKey):
+		message, code = "Unknown signing key", "unknown_key"
+	case errors.Is(err, auth.ErrUnsupportedAlg):
+		message, code = "Unsupported signing algorithm", "unsupported_algorithm"
+	case errors.Is(err, auth.ErrTokenRevoked):
+		message, code = "Token revoked", "token_revoked"
+	case errors.Is(err, auth.ErrSessionRevoked):
+		message, code = "Session revoked", "session_revoked"
+	case errors.Is(err, auth.ErrAccountDisabled):
+		message, code = "Account disabled", "account_disabled"
+	}
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": message,
+		"code":  code,
+	})
 }
 
 // GetUserIDFromContext obtiene el user_id del contexto
@@ -113,3 +305,40 @@ func GetUserIDFromContext(c *fiber.Ctx) (uuid.UUID, error) {
 	}
 	return userID, nil
 }
+
+// GetClaimsFromContext obtiene los claims verificados del contexto
+func GetClaimsFromContext(c *fiber.Ctx) (*auth.Claims, error) {
+	claims, ok := c.Locals("claims").(*auth.Claims)
+	if !ok {
+		return nil, fmt.Errorf("claims not found in context")
+	}
+	return claims, nil
+}
+
+// GetServiceFromContext obtiene el servicio interno que hace la llamada
+func GetServiceFromContext(c *fiber.Ctx) (*auth.ServicePrincipal, error) {
+	service, ok := c.Locals("service").(*auth.ServicePrincipal)
+	if !ok {
+		return nil, fmt.Errorf("service not found in context")
+	}
+	return service, nil
+}
+
+// GetActorFromContext obtiene el admin que suplanta al usuario; error si la
+// petición no es una suplantación
+func GetActorFromContext(c *fiber.Ctx) (*auth.Actor, error) {
+	actor, ok := c.Locals("actor").(*auth.Actor)
+	if !ok {
+		return nil, fmt.Errorf("actor not found in context")
+	}
+	return actor, nil
+}
+
+// GetPrincipalFromContext obtiene el principal autenticado del contexto
+func GetPrincipalFromContext(c *fiber.Ctx) (*auth.Principal, error) {
+	principal, ok := c.Locals("principal").(*auth.Principal)
+	if !ok {
+		return nil, fmt.Errorf("principal not found in context")
+	}
+	return principal, nil
+}
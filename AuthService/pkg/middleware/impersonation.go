@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// DenyImpersonation bloquea la ruta durante una suplantación aunque se haya
+// permitido escribir (contraseña, 2FA, passkeys, sesiones, consentimientos)
+func DenyImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if principal, err := GetPrincipalFromContext(c); err == nil && principal.IsImpersonated() {
+			return impersonationForbidden(c, "Action not allowed while impersonating", "impersonation_forbidden")
+		}
+		return c.Next()
+	}
+}
+
+// impersonationForbidden responde 403 y marca la petición como bloqueada en la auditoría
+func impersonationForbidden(c *fiber.Ctx, message, code string) error {
+	c.Locals("impersonation_blocked", true)
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": message,
+		"code":  code,
+	})
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireMFA permite el acceso solo a tokens con segundo factor (aal2)
+func RequireMFA() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		if !principal.HasMFA() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Two-factor authentication required",
+				"code":  "mfa_required",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequirePermission permite el acceso a usuarios con el permiso dado y a
+// servicios internos cuyo token incluya un scope con el mismo nombre
+func RequirePermission(perm string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if principal, err := GetPrincipalFromContext(c); err == nil {
+			set, err := principal.Permissions()
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve permissions"})
+			}
+			if !set.Has(perm) {
+				return Forbidden(c)
+			}
+			return c.Next()
+		}
+
+		service, err := GetServiceFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		if !service.HasScope(perm) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Missing scope " + perm,
+				"code":  "insufficient_scope",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole permite el acceso solo a principales con el rol dado
+func RequireRole(role models.RolUsuario) fiber.Handler {
+	return RequireAnyRole(role)
+}
+
+// RequireAnyRole permite el acceso a principales con al menos uno de los roles dados
+func RequireAnyRole(roles ...models.RolUsuario) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		if !principal.HasAnyRole(roles...) {
+			return Forbidden(c)
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireUser permite el acceso solo a usuarios; rechaza servicios y claves API,
+// que RequirePermission dejaría pasar con un scope del mismo nombre
+func RequireUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := GetPrincipalFromContext(c); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		return c.Next()
+	}
+}
+
+// Forbidden respuesta 403 común a guards y handlers
+func Forbidden(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "Access denied",
+		"code":  "forbidden",
+	})
+}
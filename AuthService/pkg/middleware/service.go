@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// AllowService deja pasar también a los servicios internos cuyo token incluya el
+// scope dado. Los usuarios siguen igual; sin principal ni servicio responde 401.
+func AllowService(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := GetPrincipalFromContext(c); err == nil {
+			return c.Next()
+		}
+
+		service, err := GetServiceFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		if !service.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Missing scope " + scope,
+				"code":  "insufficient_scope",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"goServices/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// VerificationChecker consulta si el email y el teléfono del usuario están verificados
+type VerificationChecker interface {
+	Status(userID uuid.UUID) (*models.VerificationStatusResponse, error)
+}
+
+// RequireVerified exige que el usuario haya verificado los contactos indicados
+// (models.VerificacionEmail, models.VerificacionTelefono). Sin requisitos deja
+// pasar todas las peticiones.
+func RequireVerified(checker VerificationChecker, required ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if len(required) == 0 {
+			return c.Next()
+		}
+
+		principal, err := GetPrincipalFromContext(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		status, err := checker.Status(principal.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		for _, r := range required {
+			switch {
+			case r == models.VerificacionEmail && status.EmailVerificadoAt == nil:
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Email not verified",
+					"code":  "email_not_verified",
+				})
+			case r == models.VerificacionTelefono && status.TelefonoVerificadoAt == nil:
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Phone not verified",
+					"code":  "phone_not_verified",
+				})
+			}
+		}
+
+		return c.Next()
+	}
+}
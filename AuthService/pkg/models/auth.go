@@ -0,0 +1,903 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CuentaLocal credenciales de email/contraseña para usuarios autenticados por este servicio
+type CuentaLocal struct {
+	IDUsuario    uuid.UUID `json:"id_usuario" gorm:"type:uuid;primaryKey"`
+	Email        string    `json:"email" gorm:"type:text;uniqueIndex"`
+	PasswordHash string    `json:"-" gorm:"type:text"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// Relaciones
+	Usuario *User `json:"usuario,omitempty" gorm:"foreignKey:IDUsuario"`
+}
+
+// TableName nombre de la tabla de cuentas locales
+func (CuentaLocal) TableName() string {
+	return "cuentas_locales"
+}
+
+// Session sesión de login de un dispositivo; agrupa la familia de refresh tokens
+// que se van rotando a partir del login
+type Session struct {
+	IDSesion      uuid.UUID  `json:"id_sesion" gorm:"type:uuid;primaryKey"`
+	IDUsuario     uuid.UUID  `json:"id_usuario" gorm:"type:uuid;index"`
+	Dispositivo   string     `json:"dispositivo"`
+	UserAgent     string     `json:"user_agent"`
+	IP            string     `json:"ip" gorm:"type:varchar(45)"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastUsedAt    time.Time  `json:"last_used_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason string     `json:"revoked_reason,omitempty" gorm:"type:varchar(30)"`
+	// AMR métodos de autenticación usados al abrir la sesión, separados por comas
+	AMR string `json:"amr" gorm:"type:varchar(100)"`
+	// SuplantadoPor admin que abrió la sesión suplantando al usuario
+	SuplantadoPor *uuid.UUID `json:"suplantado_por,omitempty" gorm:"type:uuid"`
+}
+
+// TableName nombre de la tabla de sesiones
+func (Session) TableName() string {
+	return "sesiones"
+}
+
+// OwnerID usuario dueño de la sesión
+func (s Session) OwnerID() uuid.UUID {
+	return s.IDUsuario
+}
+
+// SessionResponse sesión con la marca de si es la de la petición actual
+type SessionResponse struct {
+	Session
+	Actual bool `json:"actual"`
+}
+
+// Motivos de revocación de una sesión
+const (
+	RevocadaLogout   = "logout"
+	RevocadaReuso    = "refresh_token_reused"
+	RevocadaUsuario  = "revoked_by_user"
+	RevocadaAdmin    = "revoked_by_admin"
+	RevocadaPassword = "password_changed"
+	// RevocadaDesactivada la cuenta fue desactivada o un admin forzó el logout
+	RevocadaDesactivada = "account_disabled"
+)
+
+// RefreshToken refresh token opaco de una sesión; solo se almacena su hash.
+// Un token con UsedAt ya fue rotado: volver a presentarlo revoca la sesión.
+type RefreshToken struct {
+	IDRefreshToken uuid.UUID  `json:"id_refresh_token" gorm:"type:uuid;primaryKey"`
+	IDSesion       uuid.UUID  `json:"id_sesion" gorm:"type:uuid;index"`
+	TokenHash      string     `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	UsedAt         *time.Time `json:"used_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// DeviceInfo datos del dispositivo que inicia una sesión
+type DeviceInfo struct {
+	Dispositivo string
+	UserAgent   string
+	IP          string
+	// DeviceID identificador persistente que envía el cliente (X-Device-ID), opcional
+	DeviceID string
+}
+
+// SignupRequest DTO para registro con email y contraseña
+type SignupRequest struct {
+	Email       string `json:"email" binding:"required"`
+	Password    string `json:"password" binding:"required"`
+	Nombre      string `json:"nombre" binding:"required"`
+	Apellido    string `json:"apellido" binding:"required"`
+	Dispositivo string `json:"dispositivo"`
+}
+
+// LoginRequest DTO para login con email y contraseña
+type LoginRequest struct {
+	Email       string `json:"email" binding:"required"`
+	Password    string `json:"password" binding:"required"`
+	Dispositivo string `json:"dispositivo"`
+}
+
+// RefreshRequest DTO para renovar o revocar un refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenResponse par de tokens emitido por el servicio
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	SessionID    string `json:"session_id"`
+	User         *User  `json:"user,omitempty"`
+	// IDToken y Scope solo en el flujo authorization code (OIDC)
+	IDToken string `json:"id_token,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+}
+
+// TokenRevocado access token revocado por jti; la fila se purga al vencer el token
+type TokenRevocado struct {
+	JTI       string    `json:"jti" gorm:"type:varchar(64);primaryKey"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de tokens revocados
+func (TokenRevocado) TableName() string {
+	return "tokens_revocados"
+}
+
+// RevocacionUsuario invalida todos los tokens de un usuario emitidos antes de RevokedBefore
+type RevocacionUsuario struct {
+	IDUsuario     uuid.UUID `json:"id_usuario" gorm:"type:uuid;primaryKey"`
+	RevokedBefore time.Time `json:"revoked_before"`
+	ExpiresAt     time.Time `json:"expires_at" gorm:"index"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName nombre de la tabla de revocaciones por usuario
+func (RevocacionUsuario) TableName() string {
+	return "revocaciones_usuario"
+}
+
+// RevokeTokensRequest DTO para revocar un token por jti o los tokens de un usuario
+type RevokeTokensRequest struct {
+	JTI       string     `json:"jti"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	IDUsuario *uuid.UUID `json:"id_usuario"`
+	Before    *time.Time `json:"before"`
+}
+
+// SegundoFactor secreto TOTP del usuario; Habilitado queda en false hasta verificar el primer código
+type SegundoFactor struct {
+	IDUsuario  uuid.UUID `json:"id_usuario" gorm:"type:uuid;primaryKey"`
+	Secreto    string    `json:"-" gorm:"type:varchar(64)"`
+	Habilitado bool      `json:"habilitado" gorm:"default:false"`
+	// UltimoPaso último paso TOTP aceptado, para rechazar reusos del mismo código
+	UltimoPaso int64     `json:"-"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName nombre de la tabla de segundos factores
+func (SegundoFactor) TableName() string {
+	return "segundos_factores"
+}
+
+// CodigoRecuperacion código de recuperación de un solo uso; solo se almacena su hash
+type CodigoRecuperacion struct {
+	IDCodigo   uuid.UUID  `json:"id_codigo" gorm:"type:uuid;primaryKey"`
+	IDUsuario  uuid.UUID  `json:"id_usuario" gorm:"type:uuid;index"`
+	CodigoHash string     `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	UsedAt     *time.Time `json:"used_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de códigos de recuperación
+func (CodigoRecuperacion) TableName() string {
+	return "codigos_recuperacion"
+}
+
+// TOTPSetupResponse datos para registrar el secreto en la app autenticadora
+type TOTPSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	// QRCodePNG imagen PNG del QR en base64
+	QRCodePNG string `json:"qr_code_png"`
+}
+
+// TOTPCodeRequest DTO con un código TOTP o de recuperación
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAChallengeResponse respuesta de login cuando falta el segundo factor
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// MFAVerifyRequest DTO para completar el login con el segundo factor
+type MFAVerifyRequest struct {
+	MFAToken    string `json:"mfa_token" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	Dispositivo string `json:"dispositivo"`
+}
+
+// RecoveryCodesResponse códigos de recuperación; solo se muestran una vez
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Credential passkey (WebAuthn) registrada por un usuario
+type Credential struct {
+	IDCredencial uuid.UUID `json:"id_credencial" gorm:"type:uuid;primaryKey"`
+	IDUsuario    uuid.UUID `json:"id_usuario" gorm:"type:uuid;index"`
+	// CredentialID id asignado por el autenticador; es lo que llega en cada assertion
+	CredentialID    []byte `json:"-" gorm:"type:bytea;uniqueIndex"`
+	PublicKey       []byte `json:"-" gorm:"type:bytea"`
+	AttestationType string `json:"attestation_type" gorm:"type:varchar(30)"`
+	AAGUID          []byte `json:"-" gorm:"type:bytea"`
+	// Transports transportes soportados por el autenticador, separados por comas
+	Transports     string `json:"transports" gorm:"type:varchar(100)"`
+	BackupEligible bool   `json:"backup_eligible"`
+	BackupState    bool   `json:"backup_state"`
+	// SignCount último contador de firmas visto; si no avanza se marca CloneWarning
+	SignCount    int64      `json:"sign_count"`
+	CloneWarning bool       `json:"clone_warning" gorm:"default:false"`
+	Nombre       string     `json:"nombre" gorm:"type:varchar(100)"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+
+	// Relaciones
+	Usuario *User `json:"usuario,omitempty" gorm:"foreignKey:IDUsuario"`
+}
+
+// TableName nombre de la tabla de passkeys
+func (Credential) TableName() string {
+	return "credenciales_webauthn"
+}
+
+// OwnerID usuario dueño de la passkey
+func (c Credential) OwnerID() uuid.UUID {
+	return c.IDUsuario
+}
+
+// Tipos de ceremonia WebAuthn
+const (
+	CeremoniaRegistro = "registro"
+	CeremoniaLogin    = "login"
+)
+
+// CeremoniaWebAuthn estado de una ceremonia WebAuthn en curso (challenge); se
+// consume al finalizarla y no puede reutilizarse
+type CeremoniaWebAuthn struct {
+	IDCeremonia uuid.UUID `json:"id_ceremonia" gorm:"type:uuid;primaryKey"`
+	// IDUsuario nulo en logins con passkey, donde el usuario se conoce al final
+	IDUsuario *uuid.UUID `json:"id_usuario" gorm:"type:uuid;index"`
+	Tipo      string     `json:"tipo" gorm:"type:varchar(20)"`
+	// Datos SessionData serializada en JSON
+	Datos     string    `json:"-" gorm:"type:text"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de ceremonias WebAuthn
+func (CeremoniaWebAuthn) TableName() string {
+	return "ceremonias_webauthn"
+}
+
+// PasskeyBeginResponse opciones para navigator.credentials.create/get y el id
+// de ceremonia que debe acompañar al paso final
+type PasskeyBeginResponse struct {
+	CeremonyID string      `json:"ceremony_id"`
+	Options    interface{} `json:"options"`
+}
+
+// UpdatePasskeyRequest DTO para renombrar una passkey
+type UpdatePasskeyRequest struct {
+	Nombre string `json:"nombre" binding:"required"`
+}
+
+// CodigoOTP código de login sin contraseña (enlace mágico por email o código por
+// SMS); solo se almacena su hash y se invalida tras varios intentos fallidos
+type CodigoOTP struct {
+	IDCodigo  uuid.UUID `json:"id_codigo" gorm:"type:uuid;primaryKey"`
+	IDUsuario uuid.UUID `json:"id_usuario" gorm:"type:uuid;index"`
+	// Canal email o sms
+	Canal string `json:"canal" gorm:"type:varchar(10)"`
+	// Destino email o teléfono normalizado al que se envió el código
+	Destino    string     `json:"destino" gorm:"type:text;index"`
+	CodigoHash string     `json:"-" gorm:"type:varchar(64)"`
+	Intentos   int        `json:"intentos" gorm:"default:0"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"index"`
+	UsedAt     *time.Time `json:"used_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de códigos OTP
+func (CodigoOTP) TableName() string {
+	return "codigos_otp"
+}
+
+// OTPRequest DTO para pedir un enlace mágico (email) o un código por SMS (telefono)
+type OTPRequest struct {
+	Canal    string `json:"canal" binding:"required"`
+	Email    string `json:"email"`
+	Telefono string `json:"telefono"`
+}
+
+// OTPVerifyRequest DTO para canjear el código o el token del enlace mágico por tokens
+type OTPVerifyRequest struct {
+	Canal       string `json:"canal" binding:"required"`
+	Email       string `json:"email"`
+	Telefono    string `json:"telefono"`
+	Codigo      string `json:"codigo" binding:"required"`
+	Dispositivo string `json:"dispositivo"`
+}
+
+// Tipos de verificación de contacto
+const (
+	VerificacionEmail    = "email"
+	VerificacionTelefono = "telefono"
+)
+
+// TokenVerificacion token para confirmar un email (enlace) o un teléfono (código
+// de 6 dígitos); solo se almacena su hash
+type TokenVerificacion struct {
+	IDToken   uuid.UUID `json:"id_token" gorm:"type:uuid;primaryKey"`
+	IDUsuario uuid.UUID `json:"id_usuario" gorm:"type:uuid;index"`
+	// Tipo email o telefono
+	Tipo string `json:"tipo" gorm:"type:varchar(10)"`
+	// Destino email o teléfono normalizado que se está verificando
+	Destino   string     `json:"destino" gorm:"type:text"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);index"`
+	Intentos  int        `json:"intentos" gorm:"default:0"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de tokens de verificación
+func (TokenVerificacion) TableName() string {
+	return "tokens_verificacion"
+}
+
+// VerifyEmailRequest DTO con el token del enlace de verificación de email
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyPhoneRequest DTO con el código SMS de verificación del teléfono
+type VerifyPhoneRequest struct {
+	Codigo string `json:"codigo" binding:"required"`
+}
+
+// VerificationStatusResponse estado de verificación del email y el teléfono
+type VerificationStatusResponse struct {
+	Email                string     `json:"email,omitempty"`
+	EmailVerificadoAt    *time.Time `json:"email_verificado_at"`
+	Telefono             string     `json:"telefono,omitempty"`
+	TelefonoVerificadoAt *time.Time `json:"telefono_verificado_at"`
+}
+
+// TokenRestablecimiento token de un solo uso para restablecer la contraseña;
+// solo se almacena su hash
+type TokenRestablecimiento struct {
+	IDToken   uuid.UUID  `json:"id_token" gorm:"type:uuid;primaryKey"`
+	IDUsuario uuid.UUID  `json:"id_usuario" gorm:"type:uuid;index"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de tokens de restablecimiento
+func (TokenRestablecimiento) TableName() string {
+	return "tokens_restablecimiento"
+}
+
+// ForgotPasswordRequest DTO para pedir el enlace de restablecimiento
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// ResetPasswordRequest DTO para fijar una contraseña nueva con el token del enlace
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ChangePasswordRequest DTO para cambiar la contraseña con sesión iniciada
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// MensajeSaliente mensaje pendiente de entrega (outbox); un worker lo envía y
+// reintenta con espera creciente hasta MaxAttempts
+type MensajeSaliente struct {
+	IDMensaje uuid.UUID `json:"id_mensaje" gorm:"type:uuid;primaryKey"`
+	Canal     string    `json:"canal" gorm:"type:varchar(10)"`
+	Destino   string    `json:"destino" gorm:"type:text"`
+	Asunto    string    `json:"asunto" gorm:"type:text"`
+	Cuerpo    string    `json:"-" gorm:"type:text"`
+	Intentos  int       `json:"intentos" gorm:"default:0"`
+	// ProximoIntento momento a partir del cual el worker puede (re)intentar el envío
+	ProximoIntento time.Time  `json:"proximo_intento" gorm:"index"`
+	EnviadoAt      *time.Time `json:"enviado_at" gorm:"index"`
+	UltimoError    string     `json:"ultimo_error,omitempty" gorm:"type:text"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla outbox de mensajes
+func (MensajeSaliente) TableName() string {
+	return "mensajes_salientes"
+}
+
+// ClaveFirma clave privada ES256 de los tokens propios. La más reciente sin
+// RetiradaAt firma; las retiradas se siguen publicando en el JWKS hasta que vencen
+// los tokens que firmaron.
+type ClaveFirma struct {
+	Kid string `json:"kid" gorm:"type:varchar(64);primaryKey"`
+	// ClavePrivada PEM PKCS#8, cifrado con AES-GCM si hay secreto configurado
+	ClavePrivada string     `json:"-" gorm:"type:text"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	RetiradaAt   *time.Time `json:"retirada_at" gorm:"index"`
+}
+
+// TableName nombre de la tabla de claves de firma
+func (ClaveFirma) TableName() string {
+	return "claves_firma"
+}
+
+// SolicitudAutorizacion petición /auth/authorize pendiente de que el usuario
+// inicie sesión en la página de login y la apruebe
+type SolicitudAutorizacion struct {
+	IDSolicitud   uuid.UUID `json:"id_solicitud" gorm:"type:uuid;primaryKey"`
+	ClientID      string    `json:"client_id" gorm:"type:varchar(100)"`
+	RedirectURI   string    `json:"redirect_uri" gorm:"type:text"`
+	Scope         string    `json:"scope" gorm:"type:text"`
+	State         string    `json:"-" gorm:"type:text"`
+	Nonce         string    `json:"-" gorm:"type:text"`
+	CodeChallenge string    `json:"-" gorm:"type:varchar(128)"`
+	ExpiresAt     time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de solicitudes de autorización
+func (SolicitudAutorizacion) TableName() string {
+	return "solicitudes_autorizacion"
+}
+
+// CodigoAutorizacion código de autorización OIDC de un solo uso ligado a su
+// challenge PKCE; solo se almacena su hash
+type CodigoAutorizacion struct {
+	CodigoHash    string    `json:"-" gorm:"type:varchar(64);primaryKey"`
+	IDUsuario     uuid.UUID `json:"id_usuario" gorm:"type:uuid;index"`
+	ClientID      string    `json:"client_id" gorm:"type:varchar(100)"`
+	RedirectURI   string    `json:"redirect_uri" gorm:"type:text"`
+	Scope         string    `json:"scope" gorm:"type:text"`
+	Nonce         string    `json:"-" gorm:"type:text"`
+	CodeChallenge string    `json:"-" gorm:"type:varchar(128)"`
+	// AMR métodos con que el usuario se autenticó, separados por comas
+	AMR       string     `json:"amr" gorm:"type:varchar(100)"`
+	AuthTime  time.Time  `json:"auth_time"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index"`
+	UsedAt    *time.Time `json:"used_at"`
+	// IDSesion sesión abierta al canjear el código; se revoca si el código se reutiliza
+	IDSesion  *uuid.UUID `json:"id_sesion" gorm:"type:uuid"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de códigos de autorización
+func (CodigoAutorizacion) TableName() string {
+	return "codigos_autorizacion"
+}
+
+// OAuthTokenRequest parámetros del endpoint /auth/token (form-urlencoded o JSON)
+type OAuthTokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type"`
+	Code         string `json:"code" form:"code"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+
+	// Token exchange (RFC 8693)
+	SubjectToken       string `json:"subject_token" form:"subject_token"`
+	SubjectTokenType   string `json:"subject_token_type" form:"subject_token_type"`
+	RequestedTokenType string `json:"requested_token_type" form:"requested_token_type"`
+	Audience           string `json:"audience" form:"audience"`
+	Scope              string `json:"scope" form:"scope"`
+
+	// Client credentials; el secreto también puede llegar por HTTP Basic
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+}
+
+// TokenExchangeResponse token interno emitido por token exchange (RFC 8693 §2.2.1)
+type TokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope"`
+}
+
+// AuthorizationRequestResponse datos de una solicitud pendiente para la página de login
+type AuthorizationRequestResponse struct {
+	IDSolicitud uuid.UUID `json:"id_solicitud"`
+	ClientID    string    `json:"client_id"`
+	Scope       string    `json:"scope"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// AuthorizationRedirectResponse URL a la que la página de login debe redirigir
+type AuthorizationRedirectResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// OIDCDiscovery documento /.well-known/openid-configuration
+type OIDCDiscovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// UserInfoResponse respuesta de /auth/userinfo con claims estándar OIDC
+type UserInfoResponse struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	PhoneNumber   string `json:"phone_number,omitempty"`
+	PhoneVerified bool   `json:"phone_number_verified"`
+}
+
+// ServiceClient servicio interno autenticado con client credentials; solo se
+// almacena el hash del secreto
+type ServiceClient struct {
+	ClientID   string `json:"client_id" gorm:"type:varchar(100);primaryKey"`
+	Nombre     string `json:"nombre" gorm:"type:text"`
+	SecretHash string `json:"-" gorm:"type:varchar(64)"`
+	// Scopes y Audiences permitidos, separados por espacios
+	Scopes     string     `json:"scopes" gorm:"type:text"`
+	Audiences  string     `json:"audiences" gorm:"type:text"`
+	Activo     bool       `json:"activo" gorm:"default:true"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName nombre de la tabla de clientes de servicio
+func (ServiceClient) TableName() string {
+	return "clientes_servicio"
+}
+
+// CreateServiceClientRequest alta de un cliente de servicio
+type CreateServiceClientRequest struct {
+	ClientID  string   `json:"client_id"`
+	Nombre    string   `json:"nombre"`
+	Scopes    []string `json:"scopes"`
+	Audiences []string `json:"audiences"`
+}
+
+// ServiceClientSecretResponse cliente con su secreto; el secreto solo se muestra
+// al crearlo o rotarlo
+type ServiceClientSecretResponse struct {
+	Client       *ServiceClient `json:"client"`
+	ClientSecret string         `json:"client_secret"`
+}
+
+// ServiceTokenResponse token emitido con client credentials (RFC 6749 §4.4.3)
+type ServiceTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// ClaveAPI clave de larga duración para integraciones (p. ej. sistemas de
+// bodega). Se presenta como <prefijo>.<secreto>; solo se almacena el hash del secreto.
+type ClaveAPI struct {
+	IDClave    uuid.UUID `json:"id_clave" gorm:"type:uuid;primaryKey"`
+	Prefijo    string    `json:"prefijo" gorm:"type:varchar(20);uniqueIndex"`
+	SecretHash string    `json:"-" gorm:"type:varchar(64)"`
+	Nombre     string    `json:"nombre" gorm:"type:text"`
+	// Scopes permitidos, separados por espacios
+	Scopes string `json:"scopes" gorm:"type:text"`
+	// LimitePorMinuto peticiones por minuto permitidas a la clave
+	LimitePorMinuto int        `json:"limite_por_minuto"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy       uuid.UUID  `json:"created_by" gorm:"type:uuid"`
+	CreatedAt       time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de claves API
+func (ClaveAPI) TableName() string {
+	return "claves_api"
+}
+
+// CreateAPIKeyRequest alta de una clave API; sin expires_at vence a los 90 días
+type CreateAPIKeyRequest struct {
+	Nombre          string     `json:"nombre"`
+	Scopes          []string   `json:"scopes"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	LimitePorMinuto int        `json:"limite_por_minuto"`
+}
+
+// APIKeySecretResponse clave creada con su valor completo, que solo se muestra una vez
+type APIKeySecretResponse struct {
+	Clave  *ClaveAPI `json:"clave"`
+	APIKey string    `json:"api_key"`
+}
+
+// Rol rol con permisos; los de sistema (cliente, transportista, admin)
+// corresponden a users.rol y no se pueden borrar
+type Rol struct {
+	Nombre      string    `json:"nombre" gorm:"type:varchar(50);primaryKey"`
+	Descripcion string    `json:"descripcion" gorm:"type:text"`
+	Sistema     bool      `json:"sistema" gorm:"default:false"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName nombre de la tabla de roles
+func (Rol) TableName() string {
+	return "roles"
+}
+
+// RolPermiso permiso concedido a un rol
+type RolPermiso struct {
+	Rol     string `json:"rol" gorm:"type:varchar(50);primaryKey"`
+	Permiso string `json:"permiso" gorm:"type:varchar(100);primaryKey"`
+}
+
+// TableName nombre de la tabla de permisos por rol
+func (RolPermiso) TableName() string {
+	return "roles_permisos"
+}
+
+// UsuarioRol rol personalizado asignado a un usuario, además de users.rol
+type UsuarioRol struct {
+	IDUsuario   uuid.UUID `json:"id_usuario" gorm:"type:uuid;primaryKey"`
+	Rol         string    `json:"rol" gorm:"type:varchar(50);primaryKey;index"`
+	AsignadoPor uuid.UUID `json:"asignado_por" gorm:"type:uuid"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de roles asignados
+func (UsuarioRol) TableName() string {
+	return "usuarios_roles"
+}
+
+// RoleResponse rol con sus permisos
+type RoleResponse struct {
+	Rol
+	Permisos []string `json:"permisos"`
+}
+
+// CreateRoleRequest alta de un rol personalizado
+type CreateRoleRequest struct {
+	Nombre      string   `json:"nombre"`
+	Descripcion string   `json:"descripcion"`
+	Permisos    []string `json:"permisos"`
+}
+
+// UpdateRoleRequest cambio de un rol; permisos reemplaza la lista completa
+type UpdateRoleRequest struct {
+	Descripcion *string   `json:"descripcion"`
+	Permisos    *[]string `json:"permisos"`
+}
+
+// AssignRoleRequest asignación de un rol personalizado a un usuario
+type AssignRoleRequest struct {
+	Rol string `json:"rol"`
+}
+
+// PermissionsResponse roles y permisos efectivos del usuario
+type PermissionsResponse struct {
+	Roles    []string `json:"roles"`
+	Permisos []string `json:"permisos"`
+}
+
+// Eventos de auditoría de suplantación
+const (
+	EventoSuplantacionInicio    = "inicio"
+	EventoSuplantacionPeticion  = "peticion"
+	EventoSuplantacionBloqueada = "bloqueada"
+)
+
+// AuditoriaSuplantacion registro de una suplantación: su inicio y cada petición
+// hecha con el token
+type AuditoriaSuplantacion struct {
+	IDRegistro uuid.UUID `json:"id_registro" gorm:"type:uuid;primaryKey"`
+	IDActor    uuid.UUID `json:"id_actor" gorm:"type:uuid;index"`
+	IDUsuario  uuid.UUID `json:"id_usuario" gorm:"type:uuid;index"`
+	IDSesion   uuid.UUID `json:"id_sesion" gorm:"type:uuid;index"`
+	Evento     string    `json:"evento" gorm:"type:varchar(20)"`
+	Motivo     string    `json:"motivo,omitempty" gorm:"type:text"`
+	Metodo     string    `json:"metodo,omitempty" gorm:"type:varchar(10)"`
+	Ruta       string    `json:"ruta,omitempty" gorm:"type:text"`
+	Estado     int       `json:"estado,omitempty"`
+	IP         string    `json:"ip" gorm:"type:varchar(45)"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// TableName nombre de la tabla de auditoría de suplantaciones
+func (AuditoriaSuplantacion) TableName() string {
+	return "auditoria_suplantaciones"
+}
+
+// ImpersonateRequest inicio de una suplantación; sin permitir_escritura el
+// token solo sirve para leer
+type ImpersonateRequest struct {
+	Motivo            string `json:"motivo"`
+	PermitirEscritura bool   `json:"permitir_escritura"`
+}
+
+// ImpersonationResponse token de suplantación, sin refresh token
+type ImpersonationResponse struct {
+	AccessToken       string    `json:"access_token"`
+	TokenType         string    `json:"token_type"`
+	ExpiresIn         int64     `json:"expires_in"`
+	SessionID         string    `json:"session_id"`
+	IDUsuario         uuid.UUID `json:"id_usuario"`
+	SuplantadoPor     uuid.UUID `json:"suplantado_por"`
+	PermitirEscritura bool      `json:"permitir_escritura"`
+}
+
+// ImpersonationAuditResponse página de la auditoría de suplantaciones
+type ImpersonationAuditResponse struct {
+	Data       []AuditoriaSuplantacion `json:"data"`
+	Total      int64                   `json:"total"`
+	Page       int                     `json:"page"`
+	PageSize   int                     `json:"page_size"`
+	TotalPages int                     `json:"total_pages"`
+}
+
+// IntentoFallido fallos de autenticación recientes de una cuenta o una IP
+type IntentoFallido struct {
+	// Clave cuenta ("email:...", "phone:...", "user:...") o IP ("ip:...")
+	Clave          string     `json:"clave" gorm:"type:varchar(255);primaryKey"`
+	Fallos         int        `json:"fallos"`
+	UltimoFallo    time.Time  `json:"ultimo_fallo" gorm:"index"`
+	BloqueadaHasta *time.Time `json:"bloqueada_hasta,omitempty"`
+}
+
+// TableName nombre de la tabla de intentos fallidos
+func (IntentoFallido) TableName() string {
+	return "intentos_fallidos"
+}
+
+// RegistroLogin intento de autenticación, exitoso o fallido
+type RegistroLogin struct {
+	IDRegistro uuid.UUID `json:"id_registro" gorm:"type:uuid;primaryKey"`
+	// IDUsuario nulo si el intento fallido no corresponde a ninguna cuenta
+	IDUsuario *uuid.UUID `json:"id_usuario,omitempty" gorm:"type:uuid;index"`
+	Exito     bool       `json:"exito"`
+	// Metodo métodos de autenticación (amr) separados por comas
+	Metodo           string     `json:"metodo" gorm:"type:varchar(100)"`
+	IP               string     `json:"ip" gorm:"type:varchar(45)"`
+	UserAgent        string     `json:"user_agent"`
+	Dispositivo      string     `json:"dispositivo"`
+	Huella           string     `json:"-" gorm:"type:varchar(64)"`
+	DispositivoNuevo bool       `json:"dispositivo_nuevo"`
+	IDSesion         *uuid.UUID `json:"id_sesion,omitempty" gorm:"type:uuid"`
+	CreatedAt        time.Time  `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// TableName nombre de la tabla del historial de logins
+func (RegistroLogin) TableName() string {
+	return "historial_logins"
+}
+
+// DispositivoConocido dispositivo desde el que el usuario ya inició sesión
+type DispositivoConocido struct {
+	IDUsuario   uuid.UUID `json:"id_usuario" gorm:"type:uuid;primaryKey"`
+	Huella      string    `json:"-" gorm:"type:varchar(64);primaryKey"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip" gorm:"type:varchar(45)"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// TableName nombre de la tabla de dispositivos conocidos
+func (DispositivoConocido) TableName() string {
+	return "dispositivos_conocidos"
+}
+
+// LoginHistoryResponse página del historial de logins
+type LoginHistoryResponse struct {
+	Data       []RegistroLogin `json:"data"`
+	Total      int64           `json:"total"`
+	Page       int             `json:"page"`
+	PageSize   int             `json:"page_size"`
+	TotalPages int             `json:"total_pages"`
+}
+
+// IdentidadVinculada cuenta de un proveedor OIDC externo vinculada a un
+// usuario; el sub del proveedor identifica al usuario en cada login federado
+type IdentidadVinculada struct {
+	IDIdentidad uuid.UUID `json:"id_identidad" gorm:"type:uuid;primaryKey"`
+	IDUsuario   uuid.UUID `json:"id_usuario" gorm:"type:uuid;uniqueIndex:idx_identidad_usuario_proveedor"`
+	Proveedor   string    `json:"proveedor" gorm:"type:varchar(50);uniqueIndex:idx_identidad_proveedor_sujeto;uniqueIndex:idx_identidad_usuario_proveedor"`
+	// Sujeto claim sub del id_token del proveedor
+	Sujeto      string     `json:"sub" gorm:"type:varchar(255);uniqueIndex:idx_identidad_proveedor_sujeto"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de identidades vinculadas
+func (IdentidadVinculada) TableName() string {
+	return "identidades_vinculadas"
+}
+
+// SolicitudFederada login o vinculación en curso con un proveedor externo; se
+// consume en el callback y no puede reutilizarse
+type SolicitudFederada struct {
+	// Estado hash del parámetro state enviado al proveedor
+	Estado    string `json:"-" gorm:"type:varchar(64);primaryKey"`
+	Proveedor string `json:"proveedor" gorm:"type:varchar(50)"`
+	// IDUsuario usuario que vincula la identidad; nulo en logins
+	IDUsuario    *uuid.UUID `json:"id_usuario" gorm:"type:uuid"`
+	Nonce        string     `json:"-"`
+	CodeVerifier string     `json:"-"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"index"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName nombre de la tabla de solicitudes federadas
+func (SolicitudFederada) TableName() string {
+	return "solicitudes_federadas"
+}
+
+// FederationProviderResponse proveedor externo disponible para iniciar sesión
+type FederationProviderResponse struct {
+	ID     string `json:"id"`
+	Nombre string `json:"nombre"`
+}
+
+// FederationBeginResponse URL del proveedor a la que se redirige el navegador
+type FederationBeginResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	ExpiresIn        int64  `json:"expires_in"`
+}
+
+// LinkIdentityRequest DTO para iniciar la vinculación de un proveedor
+type LinkIdentityRequest struct {
+	Proveedor string `json:"proveedor" binding:"required"`
+}
+
+// FederationCallbackRequest DTO con el code y el state que el proveedor devolvió
+// a la página de callback
+type FederationCallbackRequest struct {
+	State       string `json:"state" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	Dispositivo string `json:"dispositivo"`
+}
+
+// AdminUserResponse usuario con el email de su cuenta local, para el listado admin
+type AdminUserResponse struct {
+	User
+	Email string `json:"email,omitempty"`
+}
+
+// AdminUserListResponse página del listado admin de usuarios
+type AdminUserListResponse struct {
+	Data       []AdminUserResponse `json:"data"`
+	Total      int64               `json:"total"`
+	Page       int                 `json:"page"`
+	PageSize   int                 `json:"page_size"`
+	TotalPages int                 `json:"total_pages"`
+}
+
+// ChangeUserRoleRequest DTO para cambiar users.rol
+type ChangeUserRoleRequest struct {
+	Rol string `json:"rol" binding:"required"`
+}
@@ -59,3 +59,8 @@ type TransportistaListResponse struct {
 	PageSize   int             `json:"page_size"`
 	TotalPages int             `json:"total_pages"`
 }
+
+// OwnerID usuario dueño del registro de transportista
+func (t Transportista) OwnerID() uuid.UUID {
+	return t.IDUsuario
+}
@@ -24,20 +24,29 @@ type User struct {
 	FotoPerfil string     `json:"foto_perfil"`
 	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt  time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// EmailVerificadoAt fecha en que se confirmó el email; nil si no está verificado
+	EmailVerificadoAt *time.Time `json:"email_verificado_at"`
+	// DesactivadoAt fecha en que un admin desactivó la cuenta; nil si está activa
+	DesactivadoAt *time.Time `json:"desactivado_at"`
 }
 
 // PerfilCliente perfil adicional del cliente
 type PerfilCliente struct {
 	IDPerfil            uuid.UUID `json:"id_perfil" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
 	IDUsuario           uuid.UUID `json:"id_usuario" gorm:"type:uuid;uniqueIndex"`
-	DocumentoIdentidad  string    `json:"documento_identidad" gorm:"uniqueIndex"`
+	// DocumentoIdentidad nulo hasta que el cliente lo registra; único si existe
+	DocumentoIdentidad  *string   `json:"documento_identidad" gorm:"uniqueIndex"`
 	Telefono            string    `json:"telefono"`
 	CreatedAt           time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt           time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 
+	// TelefonoVerificadoAt fecha en que se confirmó Telefono; se limpia si cambia
+	TelefonoVerificadoAt *time.Time `json:"telefono_verificado_at"`
+
 	// Relaciones
 	Usuario     *User        `json:"usuario,omitempty" gorm:"foreignKey:IDUsuario"`
-	Direcciones []Direccion  `json:"direcciones,omitempty"`
+	Direcciones []Direccion  `json:"direcciones,omitempty" gorm:"foreignKey:IDPerfil"`
 }
 
 // Direccion dirección del cliente
@@ -71,6 +80,13 @@ type UpdateUserRequest struct {
 	FotoPerfil string `json:"foto_perfil"`
 }
 
+// ProfileRequest DTO para crear o actualizar el perfil de cliente; los campos
+// omitidos no cambian y un string vacío los borra
+type ProfileRequest struct {
+	DocumentoIdentidad *string `json:"documento_identidad"`
+	Telefono           *string `json:"telefono"`
+}
+
 // CreateDireccionRequest DTO para crear dirección
 type CreateDireccionRequest struct {
 	Calle                  string  `json:"calle" binding:"required"`
@@ -92,3 +108,21 @@ type UpdateDireccionRequest struct {
 	Longitud               float64 `json:"longitud"`
 	EsPredeterminada       bool    `json:"es_predeterminada"`
 }
+
+// OwnerID el propio usuario es dueño de su registro
+func (u User) OwnerID() uuid.UUID {
+	return u.ID
+}
+
+// OwnerID dueño del perfil
+func (p PerfilCliente) OwnerID() uuid.UUID {
+	return p.IDUsuario
+}
+
+// OwnerID dueño de la dirección; requiere PerfilCliente precargado
+func (d Direccion) OwnerID() uuid.UUID {
+	if d.PerfilCliente == nil {
+		return uuid.Nil
+	}
+	return d.PerfilCliente.IDUsuario
+}
@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OutboxSender guarda los mensajes en la tabla outbox en lugar de enviarlos; el
+// OutboxWorker los entrega después, así un SMTP caído no falla la petición
+type OutboxSender struct {
+	db *gorm.DB
+}
+
+// NewOutboxSender crea un Sender respaldado por la tabla outbox
+func NewOutboxSender(db *gorm.DB) *OutboxSender {
+	return &OutboxSender{db: db}
+}
+
+// Send encola el mensaje para el worker
+func (s *OutboxSender) Send(ctx context.Context, msg Message) error {
+	return s.db.WithContext(ctx).Create(&models.MensajeSaliente{
+		IDMensaje:      uuid.New(),
+		Canal:          msg.Channel,
+		Destino:        msg.To,
+		Asunto:         msg.Subject,
+		Cuerpo:         msg.Body,
+		ProximoIntento: time.Now(),
+	}).Error
+}
+
+// OutboxWorkerConfig configuración del worker de la outbox
+type OutboxWorkerConfig struct {
+	// Sender entrega real de los mensajes (SMTP, stdout, archivo)
+	Sender Sender
+	// PollInterval cada cuánto se buscan mensajes pendientes (2s por defecto)
+	PollInterval time.Duration
+	// BatchSize mensajes por ronda (20 por defecto)
+	BatchSize int
+	// MaxAttempts intentos antes de abandonar un mensaje (8 por defecto)
+	MaxAttempts int
+	// Retention tiempo que se conservan los mensajes enviados o abandonados
+	// (7 días por defecto)
+	Retention time.Duration
+}
+
+// OutboxWorker entrega los mensajes pendientes de la outbox
+type OutboxWorker struct {
+	db  *gorm.DB
+	cfg OutboxWorkerConfig
+}
+
+// NewOutboxWorker crea el worker de la outbox
+func NewOutboxWorker(db *gorm.DB, cfg OutboxWorkerConfig) *OutboxWorker {
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 20
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7 * 24 * time.Hour
+	}
+	return &OutboxWorker{db: db, cfg: cfg}
+}
+
+// Start procesa la outbox en segundo plano hasta que ctx se cancele
+func (w *OutboxWorker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(w.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.ProcessBatch(ctx); err != nil {
+					log.Printf("Warning: outbox delivery failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// ProcessBatch entrega un lote de mensajes pendientes. Las filas se bloquean con
+// SKIP LOCKED para que varias instancias no envíen el mismo mensaje.
+func (w *OutboxWorker) ProcessBatch(ctx context.Context) error {
+	return w.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pending []models.MensajeSaliente
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("enviado_at IS NULL AND intentos < ? AND proximo_intento <= ?", w.cfg.MaxAttempts, time.Now()).
+			Order("proximo_intento").
+			Limit(w.cfg.BatchSize).
+			Find(&pending).Error; err != nil {
+			return err
+		}
+
+		for _, msg := range pending {
+			err := w.cfg.Sender.Send(ctx, Message{
+				Channel: msg.Canal,
+				To:      msg.Destino,
+				Subject: msg.Asunto,
+				Body:    msg.Cuerpo,
+			})
+
+			// El cuerpo lleva enlaces y códigos vigentes: se borra en cuanto el
+			// mensaje se entrega o se abandona
+			updates := map[string]interface{}{"intentos": msg.Intentos + 1}
+			if err == nil {
+				updates["enviado_at"] = time.Now()
+				updates["ultimo_error"] = ""
+				updates["cuerpo"] = ""
+			} else {
+				log.Printf("Warning: delivering %s message %s failed (attempt %d): %v", msg.Canal, msg.IDMensaje, msg.Intentos+1, err)
+				updates["ultimo_error"] = err.Error()
+				updates["proximo_intento"] = time.Now().Add(backoff(msg.Intentos + 1))
+				if msg.Intentos+1 >= w.cfg.MaxAttempts {
+					updates["cuerpo"] = ""
+				}
+			}
+			if err := tx.Model(&msg).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Cleanup borra los mensajes enviados o abandonados más antiguos que la retención
+// y vacía el cuerpo de los que aún lo conservan (filas anteriores al borrado al enviar)
+func (w *OutboxWorker) Cleanup() error {
+	err := w.db.Model(&models.MensajeSaliente{}).
+		Where("cuerpo <> '' AND (enviado_at IS NOT NULL OR intentos >= ?)", w.cfg.MaxAttempts).
+		Update("cuerpo", "").Error
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-w.cfg.Retention)
+	return w.db.Where("(enviado_at IS NOT NULL AND enviado_at < ?) OR (enviado_at IS NULL AND intentos >= ? AND created_at < ?)",
+		cutoff, w.cfg.MaxAttempts, cutoff).
+		Delete(&models.MensajeSaliente{}).Error
+}
+
+// backoff espera antes del siguiente intento: 30s, 1m, 2m... hasta 1h
+func backoff(attempt int) time.Duration {
+	d := 30 * time.Second << (attempt - 1)
+	if d > time.Hour || d <= 0 {
+		return time.Hour
+	}
+	return d
+}
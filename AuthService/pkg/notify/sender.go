@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Canales de entrega
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Message mensaje a entregar por email o SMS
+type Message struct {
+	Channel string
+	To      string
+	// Subject solo aplica a emails
+	Subject string
+	Body    string
+}
+
+// Sender entrega mensajes a los usuarios (email, SMS)
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Router entrega cada mensaje con el Sender de su canal
+type Router struct {
+	Email Sender
+	SMS   Sender
+}
+
+// Send delega en el Sender del canal del mensaje
+func (r Router) Send(ctx context.Context, msg Message) error {
+	switch msg.Channel {
+	case ChannelEmail:
+		if r.Email != nil {
+			return r.Email.Send(ctx, msg)
+		}
+	case ChannelSMS:
+		if r.SMS != nil {
+			return r.SMS.Send(ctx, msg)
+		}
+	}
+	return fmt.Errorf("no sender configured for %s messages", msg.Channel)
+}
+
+// WriterSender escribe los mensajes en un io.Writer; pensado para desarrollo local
+type WriterSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutSender escribe los mensajes en la salida estándar
+func NewStdoutSender() *WriterSender {
+	return &WriterSender{w: os.Stdout}
+}
+
+// NewFileSender agrega los mensajes al final del archivo indicado
+func NewFileSender(path string) (*WriterSender, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSender{w: f}, nil
+}
+
+// Send escribe el mensaje con su canal, destinatario y fecha
+func (s *WriterSender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "--- %s %s to=%s\n", time.Now().Format(time.RFC3339), msg.Channel, msg.To)
+	if err != nil {
+		return err
+	}
+	if msg.Subject != "" {
+		if _, err := fmt.Fprintf(s.w, "Subject: %s\n", msg.Subject); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(s.w, "%s\n", msg.Body)
+	return err
+}
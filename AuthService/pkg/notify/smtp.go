@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPConfig servidor SMTP para emails. Sin Username no se autentica, lo que
+// sirve para sustitutos locales como Mailpit o MailHog (localhost:1025).
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPSender entrega emails por SMTP
+type SMTPSender struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPSender crea un Sender SMTP
+func NewSMTPSender(cfg SMTPConfig) *SMTPSender {
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	return &SMTPSender{cfg: cfg}
+}
+
+// Send envía el mensaje como email de texto plano en UTF-8
+func (s *SMTPSender) Send(_ context.Context, msg Message) error {
+	if msg.Channel != ChannelEmail {
+		return fmt.Errorf("smtp sender cannot deliver %s messages", msg.Channel)
+	}
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+
+	headers := []string{
+		"From: " + s.cfg.From,
+		"To: " + msg.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+	body := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(msg.Body, "\n", "\r\n")
+
+	return smtp.SendMail(net.JoinHostPort(s.cfg.Host, s.cfg.Port), auth, s.cfg.From, []string{msg.To}, []byte(body))
+}
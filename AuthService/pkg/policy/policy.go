@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"errors"
+
+	"goServices/pkg/auth"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound se devuelve tanto si el recurso no existe como si es ajeno,
+// para no revelar la existencia de recursos de otros usuarios
+var ErrNotFound = errors.New("resource not found")
+
+// Action acción que se quiere realizar sobre un recurso
+type Action string
+
+const (
+	ActionView   Action = "view"
+	ActionEdit   Action = "edit"
+	ActionDelete Action = "delete"
+)
+
+// Resource recurso con un usuario propietario
+type Resource interface {
+	OwnerID() uuid.UUID
+}
+
+// Can indica si el principal puede realizar la acción sobre el recurso.
+// El propietario puede todo; los admins solo pueden ver recursos ajenos.
+func Can(p *auth.Principal, action Action, r Resource) bool {
+	if p == nil || r == nil {
+		return false
+	}
+
+	owner := r.OwnerID()
+	if owner != uuid.Nil && owner == p.UserID {
+		return true
+	}
+
+	return action == ActionView && p.IsAdmin()
+}
+
+// CanView atajo para Can(p, ActionView, r)
+func CanView(p *auth.Principal, r Resource) bool {
+	return Can(p, ActionView, r)
+}
+
+// CanEdit atajo para Can(p, ActionEdit, r)
+func CanEdit(p *auth.Principal, r Resource) bool {
+	return Can(p, ActionEdit, r)
+}
+
+// CanDelete atajo para Can(p, ActionDelete, r)
+func CanDelete(p *auth.Principal, r Resource) bool {
+	return Can(p, ActionDelete, r)
+}
+
+// Authorize devuelve ErrNotFound si el principal no puede realizar la acción
+func Authorize(p *auth.Principal, action Action, r Resource) error {
+	if !Can(p, action, r) {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"goServices/pkg/auth"
+	"goServices/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+func TestCan(t *testing.T) {
+	owner := uuid.New()
+	other := uuid.New()
+
+	ownerPrincipal := &auth.Principal{UserID: owner, Roles: []string{string(models.RolCliente)}}
+	otherPrincipal := &auth.Principal{UserID: other, Roles: []string{string(models.RolCliente)}}
+	adminPrincipal := &auth.Principal{UserID: uuid.New(), Roles: []string{string(models.RolAdmin)}}
+
+	address := models.Direccion{
+		IDDireccion:   uuid.New(),
+		PerfilCliente: &models.PerfilCliente{IDUsuario: owner},
+	}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		action    Action
+		resource  Resource
+		want      bool
+	}{
+		{"owner views", ownerPrincipal, ActionView, address, true},
+		{"owner edits", ownerPrincipal, ActionEdit, address, true},
+		{"owner deletes", ownerPrincipal, ActionDelete, address, true},
+		{"other views", otherPrincipal, ActionView, address, false},
+		{"other edits", otherPrincipal, ActionEdit, address, false},
+		{"other deletes", otherPrincipal, ActionDelete, address, false},
+		{"admin views", adminPrincipal, ActionView, address, true},
+		{"admin edits", adminPrincipal, ActionEdit, address, false},
+		{"admin deletes", adminPrincipal, ActionDelete, address, false},
+		{"own user record", ownerPrincipal, ActionEdit, models.User{ID: owner}, true},
+		{"foreign user record", otherPrincipal, ActionView, models.User{ID: owner}, false},
+		{"address without profile", ownerPrincipal, ActionView, models.Direccion{}, false},
+		{"nil owner never matches", &auth.Principal{UserID: uuid.Nil}, ActionEdit, models.Session{}, false},
+		{"nil principal", nil, ActionView, address, false},
+		{"nil resource", ownerPrincipal, ActionView, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Can(tt.principal, tt.action, tt.resource); got != tt.want {
+				t.Errorf("Can() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortcuts(t *testing.T) {
+	owner := uuid.New()
+	principal := &auth.Principal{UserID: owner}
+	foreign := models.PerfilCliente{IDUsuario: uuid.New()}
+	own := models.PerfilCliente{IDUsuario: owner}
+
+	if !CanView(principal, own) || !CanEdit(principal, own) || !CanDelete(principal, own) {
+		t.Error("owner should be allowed every action on its own profile")
+	}
+	if CanView(principal, foreign) || CanEdit(principal, foreign) || CanDelete(principal, foreign) {
+		t.Error("a foreign profile should not be accessible")
+	}
+}
+
+func TestAuthorizeTreatsForeignAsNotFound(t *testing.T) {
+	owner := uuid.New()
+	resource := models.Transportista{IDUsuario: owner}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		action    Action
+		wantErr   error
+	}{
+		{"owner", &auth.Principal{UserID: owner}, ActionEdit, nil},
+		{"foreign edit", &auth.Principal{UserID: uuid.New()}, ActionEdit, ErrNotFound},
+		{"foreign view", &auth.Principal{UserID: uuid.New()}, ActionView, ErrNotFound},
+		{"admin delete", &auth.Principal{UserID: uuid.New(), Roles: []string{string(models.RolAdmin)}}, ActionDelete, ErrNotFound},
+		{"admin view", &auth.Principal{UserID: uuid.New(), Roles: []string{string(models.RolAdmin)}}, ActionView, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Authorize(tt.principal, tt.action, resource); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authorize() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}